@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
+)
+
+// startBridges brings up every bridge concurrently. A failing device only
+// records its error; the others keep going.
+func startBridges(ctx context.Context, bridges []*bridge.Bridge) {
+	var wg sync.WaitGroup
+	for _, b := range bridges {
+		wg.Add(1)
+		go func(b *bridge.Bridge) {
+			defer wg.Done()
+			b.Start(ctx)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// allDown returns a channel that is closed once every bridge is down for
+// good, either because ctx is done or because its device could not be
+// brought back.
+func allDown(bridges []*bridge.Bridge) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for _, b := range bridges {
+			<-b.Done()
+		}
+		close(done)
+	}()
+	return done
+}
+
+func stopBridges(bridges []*bridge.Bridge) {
+	var wg sync.WaitGroup
+	for _, b := range bridges {
+		wg.Add(1)
+		go func(b *bridge.Bridge) {
+			defer wg.Done()
+			b.Stop()
+		}(b)
+	}
+	wg.Wait()
+}
+
+func printSummary(bridges []*bridge.Bridge) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UDID\tNAME\tPORT\tSTATUS")
+	for _, b := range bridges {
+		status := "✅ ready"
+		if err := b.Err(); err != nil {
+			status = "❌ " + firstLine(err.Error())
+		}
+		d := b.Device()
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", d.UDID, d.Name, b.Port(), status)
+	}
+	w.Flush()
+}
+
+// noneBridged reports that every bridge failed, with the exit code most of
+// them failed with.
+func noneBridged(bridges []*bridge.Bridge) error {
+	errs := make([]error, len(bridges))
+	for i, b := range bridges {
+		errs[i] = b.Err()
+	}
+	return &summaryError{"No device could be bridged", commonError(errs)}
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i]
+	}
+	return s
+}
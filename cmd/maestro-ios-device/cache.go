@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/runner"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+)
+
+func cache(args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	profile := fs.String("profile", "", "Config profile to read build-cache from")
+	fs.Parse(args[1:])
+
+	c, err := openCache(*profile, fs)
+	if err != nil {
+		fatal("%w", err)
+	}
+
+	switch args[0] {
+	case "ls", "list":
+		entries, err := c.List()
+		if err != nil {
+			fatal("%w", err)
+		}
+		if len(entries) == 0 {
+			fmt.Printf("No cached builds in %s\n", c.Root)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tSIZE\tTEAM\tDESTINATION\tXCODE")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Created.Local().Format(time.DateTime),
+				formatSize(e.Size), utils.OrDash(e.Key.TeamID), e.Key.Destination, utils.OrDash(e.Key.Xcode))
+		}
+		w.Flush()
+	case "clean":
+		n, err := c.Clean()
+		if err != nil {
+			fatal("Clean failed: %w", err)
+		}
+		fmt.Printf("🧹 Removed %d cached build(s) from %s\n", n, c.Root)
+	default:
+		usage()
+	}
+}
+
+// openCache returns the cache in the configured build-cache dir, or the
+// default one.
+func openCache(profile string, fs *flag.FlagSet) (*runner.Cache, error) {
+	cfg, err := loadConfig(profile, fs)
+	if err != nil {
+		return nil, err
+	}
+	if dir := cfg.Path(config.BuildCache); dir != "" {
+		return &runner.Cache{Root: dir}, nil
+	}
+	return runner.DefaultCache()
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+)
+
+// flagKeys maps command-line flags to config settings.
+var flagKeys = map[string]string{
+	"team-id":          config.TeamID,
+	"device":           config.Device,
+	"driver-host-port": config.Port,
+}
+
+// loadConfig resolves settings, with only the flags the user actually set
+// taking part in the merge.
+func loadConfig(profile string, fs *flag.FlagSet) (*config.Config, error) {
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			flags[key] = f.Value.String()
+		}
+	})
+	return config.Resolve(profile, flags)
+}
+
+// resolveDevices returns the --device queries with aliases resolved, or the
+// configured device when none were given.
+func resolveDevices(cfg *config.Config, queries []string) []string {
+	if len(queries) == 0 && cfg.String(config.Device) != "" {
+		return []string{cfg.String(config.Device)}
+	}
+	resolved := make([]string, len(queries))
+	for i, q := range queries {
+		resolved[i] = cfg.ResolveDevice(q)
+	}
+	return resolved
+}
+
+func showConfig(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fatal("%w: maestro-ios-device config show [--profile NAME]", errUsage)
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	profile := fs.String("profile", "", "Config profile to use")
+	fs.Parse(args[1:])
+
+	cfg, err := loadConfig(*profile, fs)
+	if err != nil {
+		fatal("%w", err)
+	}
+
+	if len(cfg.Files) == 0 {
+		fmt.Printf("Config files: none (create ~/%s or ./%s)\n", config.FileName, config.FileName)
+	} else {
+		fmt.Println("Config files:")
+		for _, f := range cfg.Files {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	if cfg.Profile != "" {
+		fmt.Printf("Profile: %s (from %s)\n", cfg.Profile, cfg.ProfileSource)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, key := range config.Keys() {
+		e, ok := cfg.Lookup(key)
+		if !ok {
+			fmt.Fprintf(w, "%s\t-\tdefault (%s)\n", key, config.EnvVar(key))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, e.Value, e.Source)
+	}
+	w.Flush()
+}
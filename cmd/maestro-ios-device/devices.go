@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/registry"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+)
+
+type deviceInfo struct {
+	UDID        string `json:"udid"`
+	Name        string `json:"name"`
+	OSVersion   string `json:"iosVersion"`
+	ProductType string `json:"productType"`
+	Paired      bool   `json:"paired"`
+	BridgePort  int    `json:"bridgePort,omitempty"`
+}
+
+func devices(args []string) {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print devices as JSON")
+	fs.Parse(args)
+
+	list, err := device.List()
+	if err != nil {
+		fatal("Failed to list devices: %w", err)
+	}
+
+	// One registry read for all devices; each read stats every entry's PID.
+	bridges := map[string]int{}
+	if entries, err := registry.List(); err == nil {
+		for _, e := range entries {
+			bridges[e.UDID] = e.Port
+		}
+	}
+
+	infos := make([]deviceInfo, 0, len(list))
+	for _, d := range list {
+		info := deviceInfo{
+			UDID:        d.Serial,
+			Name:        d.Name,
+			OSVersion:   d.OSVersion,
+			ProductType: d.ProductType,
+			Paired:      d.Paired,
+			BridgePort:  bridges[d.Serial],
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(infos); err != nil {
+			fatal("%w", err)
+		}
+		return
+	}
+
+	if len(infos) == 0 {
+		fmt.Println("No devices connected.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UDID\tNAME\tIOS\tPRODUCT\tBRIDGE")
+	for _, d := range infos {
+		bridge := "-"
+		if d.BridgePort != 0 {
+			bridge = fmt.Sprintf("port %d", d.BridgePort)
+		}
+		if !d.Paired {
+			bridge = "not paired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.UDID, d.Name, utils.OrDash(d.OSVersion), utils.OrDash(d.ProductType), bridge)
+	}
+	w.Flush()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/runner"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+)
+
+// Exit codes. Keep in sync with the table in the README.
+const (
+	exitError       = 1 // anything not listed below
+	exitUsage       = 2 // bad flags, arguments or config
+	exitNotPatched  = 3 // Maestro missing, unsupported or not patched
+	exitNoDevice    = 4 // no device, unknown device or ambiguous --device
+	exitBuild       = 5 // xcodebuild build-for-testing failed
+	exitRunner      = 6 // runner failed to start or could not be restarted
+	exitPortForward = 7 // port in use, forward failed or driver unreachable
+	exitSigning     = 8 // Team ID could not be detected
+	exitMaestro     = 9 // Maestro failed with a status other than 1, or was killed
+)
+
+var errUsage = errors.New("Usage")
+
+// summaryError reports msg while carrying err for its exit code, for when
+// the details have already been printed.
+type summaryError struct {
+	msg string
+	err error
+}
+
+func (e *summaryError) Error() string { return e.msg }
+func (e *summaryError) Unwrap() error { return e.err }
+
+// maestroExit is a Maestro run that failed, carrying Maestro's own status.
+// Only status 1, failed flows, is passed through; any other would read as
+// one of the codes above, so it exits with exitMaestro.
+type maestroExit struct {
+	code int
+}
+
+func (e *maestroExit) Error() string {
+	if e.code < 0 {
+		return "Maestro was killed by a signal"
+	}
+	return fmt.Sprintf("Maestro exited with status %d", e.code)
+}
+
+func (e *maestroExit) exitCode() int {
+	if e.code == 1 {
+		return exitError
+	}
+	return exitMaestro
+}
+
+// exitCode maps an error to the exit code scripts can branch on.
+func exitCode(err error) int {
+	is := func(targets ...error) bool {
+		for _, t := range targets {
+			if errors.Is(err, t) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var maestroErr *maestroExit
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &maestroErr):
+		return maestroErr.exitCode()
+	case is(errUsage, config.ErrInvalid, config.ErrProfileNotFound):
+		return exitUsage
+	case is(maestro.ErrNotInstalled, maestro.ErrNotPatched, maestro.ErrUnsupported, maestro.ErrRunnerNotFound):
+		return exitNotPatched
+	case is(device.ErrNotFound, device.ErrNoDevices, device.ErrAmbiguous):
+		return exitNoDevice
+	case is(runner.ErrBuildFailed):
+		return exitBuild
+	case is(runner.ErrStartFailed, watchdog.ErrGaveUp):
+		return exitRunner
+	case is(utils.ErrPortInUse, utils.ErrNoFreePort, portforward.ErrForwardFailed, portforward.ErrForwarderDown, portforward.ErrDriverDown):
+		return exitPortForward
+	case is(signing.ErrNoTeam, signing.ErrMultipleTeams):
+		return exitSigning
+	}
+	return exitError
+}
+
+// commonError returns the first of errs with the exit code most of them
+// map to, the lowest code on a tie, so the code of several failures does not
+// depend on their order.
+func commonError(errs []error) error {
+	count := make(map[int]int)
+	first := make(map[int]error)
+	for _, err := range errs {
+		code := exitCode(err)
+		count[code]++
+		if _, ok := first[code]; !ok {
+			first[code] = err
+		}
+	}
+	best := -1
+	for code, n := range count {
+		if best < 0 || n > count[best] || n == count[best] && code < best {
+			best = code
+		}
+	}
+	return first[best]
+}
+
+// fatal prints the error and exits with its code. Wrap errors with %w so
+// the code is preserved. Deferred calls do not run.
+func fatal(format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	fmt.Printf("❌ %s\n", err)
+	os.Exit(exitCode(err))
+}
+
+// usage prints the help and exits with exitUsage.
+func usage() {
+	printUsage()
+	os.Exit(exitUsage)
+}
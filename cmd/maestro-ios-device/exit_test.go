@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/runner"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+)
+
+func TestExitCode(t *testing.T) {
+	diag := &diagnose.Error{Code: diagnose.DeviceLocked, Cause: "locked"}
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("boom"), exitError},
+		{fmt.Errorf("%w: backup restore <id>", errUsage), exitUsage},
+		{fmt.Errorf("%w port \"x\" from env", config.ErrInvalid), exitUsage},
+		{fmt.Errorf("%w. Run: setup", maestro.ErrNotPatched), exitNotPatched},
+		{fmt.Errorf("Setup failed: %w", &maestro.UnsupportedVersionError{Version: "1.0.0"}), exitNotPatched},
+		{fmt.Errorf("%w: abc", device.ErrNotFound), exitNoDevice},
+		{fmt.Errorf("%w, pass --device", device.ErrAmbiguous), exitNoDevice},
+		{fmt.Errorf("%w: %w", runner.ErrBuildFailed, diag), exitBuild},
+		{fmt.Errorf("%w: %w", runner.ErrStartFailed, diag), exitRunner},
+		{fmt.Errorf("runner exited; %w after 5 restart(s)", watchdog.ErrGaveUp), exitRunner},
+		{fmt.Errorf("%w: 6001", utils.ErrPortInUse), exitPortForward},
+		{fmt.Errorf("port 6001: %w", portforward.ErrDriverDown), exitPortForward},
+		{fmt.Errorf("Could not detect Team ID: %w", signing.ErrMultipleTeams), exitSigning},
+		{&maestroExit{1}, 1},
+		{&maestroExit{3}, exitMaestro},
+		{&maestroExit{-1}, exitMaestro},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCommonError(t *testing.T) {
+	locked := fmt.Errorf("%w: locked", runner.ErrStartFailed)
+	build := fmt.Errorf("%w: signing", runner.ErrBuildFailed)
+	port := fmt.Errorf("%w: 6001", utils.ErrPortInUse)
+
+	tests := []struct {
+		name string
+		errs []error
+		want int
+	}{
+		{"one", []error{port}, exitPortForward},
+		{"most common", []error{port, locked, locked}, exitRunner},
+		{"tie takes the lowest code", []error{port, locked, build, locked, build}, exitBuild},
+		{"order does not matter", []error{build, locked, port, build, locked}, exitBuild},
+	}
+	for _, tt := range tests {
+		if got := exitCode(commonError(tt.errs)); got != tt.want {
+			t.Errorf("%s: exitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
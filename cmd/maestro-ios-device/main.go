@@ -2,26 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/doctor"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
 	"github.com/anthropics/maestro-ios-device/internal/maestro"
-	"github.com/anthropics/maestro-ios-device/internal/portforward"
-	"github.com/anthropics/maestro-ios-device/internal/runner"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
 	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
 )
 
 var version = "dev" // set via -ldflags
 
-func fatal(format string, args ...any) {
-	fmt.Printf("❌ "+format+"\n", args...)
-	os.Exit(1)
-}
-
 func printBanner() {
 	fmt.Printf("maestro-ios-device %s\n", version)
 	fmt.Println("  🚀 3.6x faster, real iOS device support, runs locally or on any Appium cloud,")
@@ -32,24 +31,156 @@ func printBanner() {
 }
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "setup" {
-		printBanner()
-		if err := maestro.RunSetup(); err != nil {
-			fatal("Setup failed: %s", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "setup":
+			setup(os.Args[2:])
+			return
+		case "uninstall", "--uninstall":
+			uninstall(os.Args[2:])
+			return
+		case "backup":
+			backup(os.Args[2:])
+			return
+		case "compat":
+			compat(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "devices":
+			devices(os.Args[2:])
+			return
+		case "config":
+			showConfig(os.Args[2:])
+			return
+		case "cache":
+			cache(os.Args[2:])
+			return
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "test":
+			test(os.Args[2:])
+			return
 		}
-		return
 	}
 	run()
 }
 
+func setup(args []string) {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	from := fs.String("from", "", "Install from a local directory or zip instead of downloading")
+	compatFile := fs.String("compat", "", "Use a local compatibility manifest")
+	fs.Parse(args)
+
+	printBanner()
+	if err := maestro.RunSetup(maestro.SetupOptions{From: *from, Compat: *compatFile}); err != nil {
+		fatal("Setup failed: %w", err)
+	}
+}
+
+func uninstall(args []string) {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	removeRunner := fs.Bool("remove-runner", false, "Also remove ~/.maestro/maestro-ios-xctest-runner")
+	fs.Parse(args)
+
+	printBanner()
+	if err := maestro.RunUninstall(*removeRunner); err != nil {
+		fatal("Uninstall failed: %w", err)
+	}
+}
+
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	teamID := fs.String("team-id", "", "Apple Developer Team ID to check signing for")
+	deviceUDID := fs.String("device", "", "Device UDID to check")
+	port := fs.Int("driver-host-port", 0, "Local port to check (default: auto-assign from 6001)")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+	fs.Parse(args)
+
+	results := doctor.Run(doctor.Options{TeamID: *teamID, UDID: *deviceUDID, Port: *port})
+	if *asJSON {
+		if err := doctor.PrintJSON(os.Stdout, results); err != nil {
+			fatal("%w", err)
+		}
+	} else {
+		printBanner()
+		doctor.Print(os.Stdout, results)
+	}
+
+	if doctor.Failed(results) {
+		os.Exit(1)
+	}
+}
+
+func compat(args []string) {
+	fs := flag.NewFlagSet("compat", flag.ExitOnError)
+	file := fs.String("file", "", "Use a local compatibility manifest")
+	fs.Parse(args)
+
+	if err := maestro.RunCompat(*file); err != nil {
+		fatal("%w", err)
+	}
+}
+
+func backup(args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "list":
+		if err := maestro.RunBackupList(); err != nil {
+			fatal("%w", err)
+		}
+	case "restore":
+		if len(args) < 2 {
+			fatal("%w: maestro-ios-device backup restore <id>", errUsage)
+		}
+		if err := maestro.RunBackupRestore(args[1]); err != nil {
+			fatal("Restore failed: %w", err)
+		}
+	default:
+		usage()
+	}
+}
+
 func run() {
-	teamID := flag.String("team-id", "", "Apple Developer Team ID (required)")
-	deviceUDID := flag.String("device", "", "Target device UDID (required)")
-	port := flag.Int("driver-host-port", 0, "Local port (default: auto-assign from 6001)")
-	showVersion := flag.Bool("version", false, "Show version")
-	help := flag.Bool("help", false, "Show help")
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	flag.Parse()
+	// Ctrl+C during build/startup aborts every device
+	if err := runBridges(ctx, os.Args[1:]); err != nil {
+		cancel()
+		fatal("%w", err)
+	}
+}
+
+// executor runs maestro for the test subcommand; bridges run xcodebuild
+// through runner.SetExecutor. Tests swap in an execx.Fake.
+var executor execx.Executor = execx.OS{}
+
+// runBridges bridges the devices selected by args until ctx is done.
+func runBridges(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("maestro-ios-device", flag.ContinueOnError)
+	fs.Usage = printUsage
+	teamID := fs.String("team-id", "", "Apple Developer Team ID (default: auto-detect)")
+	var deviceQueries stringList
+	fs.Var(&deviceQueries, "device", "Target device UDID, UDID prefix or name; repeatable (default: the only connected device)")
+	allDevices := fs.Bool("all-devices", false, "Bridge every connected device")
+	port := fs.Int("driver-host-port", 0, "Local port (default: auto-assign from 6001)")
+	maxRestarts := fs.Int("max-restarts", watchdog.DefaultOptions().MaxRestarts, "Restart a crashed or unresponsive runner at most this many times (0 disables)")
+	profile := fs.String("profile", "", "Config profile to use")
+	showVersion := fs.Bool("version", false, "Show version")
+	help := fs.Bool("help", false, "Show help")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
 
 	if *showVersion {
 		fmt.Printf("maestro-ios-device %s\n", version)
@@ -57,72 +188,117 @@ func run() {
 		fmt.Println("  true parallel execution, no paywall. Fixes 78% of Maestro's top issues. Same YAML.")
 		fmt.Println("  https://github.com/devicelab-dev/maestro-runner")
 		fmt.Println("  Built by DeviceLab — https://devicelab.dev")
-		return
+		return nil
 	}
 
 	printBanner()
 
 	if *help {
 		printUsage()
-		return
+		return nil
 	}
 
-	if *teamID == "" || *deviceUDID == "" {
-		printUsage()
-		os.Exit(1)
+	cfg, err := loadConfig(*profile, fs)
+	if err != nil {
+		return err
 	}
+	*teamID = cfg.String(config.TeamID)
+	*port = cfg.Int(config.Port)
+	deviceQueries = resolveDevices(cfg, deviceQueries)
 
 	if ok, _ := maestro.IsPatched(); !ok {
-		fatal("Maestro not patched. Run: maestro-ios-device setup")
+		return fmt.Errorf("%w. Run: maestro-ios-device setup", maestro.ErrNotPatched)
 	}
 
-	localPort, err := utils.ResolvePort(*port)
-	if err != nil {
-		fatal("%s", err)
+	if *teamID, err = resolveTeam(*teamID); err != nil {
+		return err
 	}
 
-	dev, err := device.Get(*deviceUDID)
+	devs, err := selectDevices(deviceQueries, *allDevices)
 	if err != nil {
-		fatal("%s", err)
+		return err
 	}
-	fmt.Printf("📱 %s (%s) - iOS %s\n\n", dev.Name, dev.Serial, dev.OSVersion)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Build & start runner
-	r := runner.New(*deviceUDID, *teamID)
-	defer r.Cleanup()
-
-	if err := r.Build(ctx); err != nil {
-		fatal("Build failed: %s", err)
+	ports, err := utils.ResolvePorts(*port, len(devs))
+	if err != nil {
+		return err
 	}
 
-	if err := r.Start(ctx); err != nil {
-		fatal("Start failed: %s", err)
+	bridges := make([]*bridge.Bridge, len(devs))
+	for i, d := range devs {
+		fmt.Printf("📱 %s (%s) - iOS %s\n", d.Name, d.Serial, d.OSVersion)
+		opts := bridge.Options{
+			UDID:           d.Serial,
+			TeamID:         *teamID,
+			Port:           ports[i],
+			CacheDir:       cfg.Path(config.BuildCache),
+			BuildTimeout:   cfg.Duration(config.BuildTimeout),
+			StartupTimeout: cfg.Duration(config.StartupTimeout),
+			MaxRestarts:    *maxRestarts,
+		}
+		if len(devs) > 1 {
+			opts.LogPrefix = fmt.Sprintf("[%s] ", utils.ShortUDID(d.Serial))
+		}
+		if bridges[i], err = bridge.New(opts); err != nil {
+			return err
+		}
 	}
+	fmt.Println()
 
-	pf := portforward.New(dev.Entry, uint16(localPort), runner.DevicePort)
-	defer pf.Stop()
+	startBridges(ctx, bridges)
+	defer stopBridges(bridges)
 
-	if err := pf.Start(); err != nil {
-		fatal("Port forward failed: %s", err)
+	if ctx.Err() != nil {
+		fmt.Println("\n🛑 Stopping...")
+		return nil
 	}
 
-	if err := pf.Verify(); err != nil {
-		fatal("%s", err)
+	var ready []*bridge.Bridge
+	for _, b := range bridges {
+		if b.Err() == nil {
+			ready = append(ready, b)
+		}
 	}
 
-	fmt.Println()
-	fmt.Println("✅ Ready! Run:")
-	fmt.Printf("   maestro --driver-host-port %d --device %s --app-file /path/to/app.ipa test flow.yaml\n\n", localPort, *deviceUDID)
+	if len(bridges) == 1 {
+		b := bridges[0]
+		if err := b.Err(); err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Println("✅ Ready! Run:")
+		fmt.Printf("   maestro --driver-host-port %d --device %s --app-file /path/to/app.ipa test flow.yaml\n\n", b.Port(), b.Device().UDID)
+	} else {
+		fmt.Println()
+		printSummary(bridges)
+		if len(ready) == 0 {
+			return noneBridged(bridges)
+		}
+		fmt.Println()
+		fmt.Printf("✅ %d of %d devices ready. Run Maestro with the --driver-host-port and --device shown above.\n\n", len(ready), len(bridges))
+	}
 	fmt.Println("Press Ctrl+C to stop.")
 
-	<-sigChan
-	fmt.Println("\n🛑 Stopping...")
+	select {
+	case <-ctx.Done():
+		fmt.Println("\n🛑 Stopping...")
+		return nil
+	case <-allDown(ready):
+		return &summaryError{"Runner could not be restarted", watchdog.ErrGaveUp}
+	}
+}
+
+// resolveTeam returns teamID, or the detected one when it is empty.
+func resolveTeam(teamID string) (string, error) {
+	if teamID != "" {
+		return teamID, nil
+	}
+	team, err := signing.Detect()
+	if err != nil {
+		return "", fmt.Errorf("Could not detect Team ID: %w", err)
+	}
+	fmt.Printf("🔑 Using Team ID %s (%s)\n", team.ID, team.Identity)
+	return team.ID, nil
 }
 
 func printUsage() {
@@ -134,14 +310,30 @@ func printUsage() {
    https://github.com/devicelab-dev/maestro-runner
 
 Usage:
-  maestro-ios-device --team-id TEAM_ID --device UDID [options]
-
-Required:
-  --team-id       Apple Developer Team ID
-  --device        iOS device UDID
+  maestro-ios-device [--team-id TEAM_ID] [--device UDID]... [--all-devices] [options]
+  maestro-ios-device setup [--from <dir|zip>] [--compat <file>]
+  maestro-ios-device compat [--file <file>]
+  maestro-ios-device doctor [--team-id ID] [--device UDID] [--json]
+  maestro-ios-device devices [--json]
+  maestro-ios-device config show [--profile NAME]
+  maestro-ios-device cache ls|clean
+  maestro-ios-device test [--device UDID] --app-file <app.ipa> <flows>... [maestro test options]
+  maestro-ios-device test --shard [--device UDID]... [--all-devices] [--retries N] [--report FILE] --app-file <app.ipa> <flows>...
+  maestro-ios-device serve [--addr HOST:PORT|unix:PATH] [--team-id ID]
+  maestro-ios-device uninstall [--remove-runner]
+  maestro-ios-device backup list
+  maestro-ios-device backup restore <id>
 
 Options:
+  --team-id            Apple Developer Team ID (default: auto-detect)
+  --device             Device UDID, UDID prefix or name; repeat for several devices
+                       (default: the only connected device)
+  --all-devices        Bridge every connected device, one port each
   --driver-host-port   Local port for Maestro connection (default: 6001)
+  --max-restarts       Restart a crashed or unresponsive runner at most this
+                       many times (default: 5, 0 disables)
+  --profile            Config profile from .maestro-ios-device.yaml
+  --uninstall          Restore original Maestro installation
   --version            Show version
   --help               Show this help
 
@@ -151,11 +343,28 @@ Examples:
   Then run tests:
   maestro --driver-host-port 6001 --device 00008030-001234567890 test flow.yaml
 
+Config:
+  Settings are read from ~/.maestro-ios-device.yaml and a project-local
+  .maestro-ios-device.yaml, and MAESTRO_IOS_* env vars such as
+  MAESTRO_IOS_TEAM_ID. Flags win over env, env over files.
+
+Build cache:
+  The XCTest runner is built once per runner version, Xcode version, Team ID
+  and platform, then reused from ~/.maestro/cache/builds (or build-cache from
+  the config). List or remove cached builds with: maestro-ios-device cache ls|clean
+
+Serve:
+  serve keeps running and starts or stops bridges on request through a local
+  HTTP/JSON API (default 127.0.0.1:7001), e.g.
+  curl -X POST localhost:7001/bridges?wait=true -d '{"udid":"00008030-..."}'
+
 Finding your Team ID:
-  security find-identity -v -p codesigning | grep "Developer"
+  Detected automatically from your signing identities and provisioning
+  profiles when there is only one team. Otherwise pick one from:
+  security find-identity -v -p codesigning
 
 Finding your Device UDID:
-  xcrun xctrace list devices
+  maestro-ios-device devices
 
 Docs: https://github.com/devicelab-dev/maestro-ios-device
 Built by DeviceLab — https://devicelab.dev`)
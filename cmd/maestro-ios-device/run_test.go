@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/fakemac"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/registry"
+	"github.com/anthropics/maestro-ios-device/internal/shard"
+)
+
+const testUDID = fakemac.UDID
+
+type harness struct {
+	exec    *execx.Fake
+	devices *device.Fake
+	port    int
+}
+
+// newHarness fakes a Mac with a patched Maestro, Xcode and one connected
+// iPhone whose driver answers on the forwarded port.
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	mac := fakemac.New(t)
+	h := &harness{exec: mac.Exec, devices: mac.Devices, port: freePort(t)}
+	h.exec.Handle("maestro", func(_ context.Context, args []string, out io.Writer) error {
+		switch args[0] {
+		case "--version":
+			fmt.Fprintln(out, "2.1.0")
+		case "--help":
+			fmt.Fprintln(out, "  --driver-host-port=<port>  Port of the driver")
+		}
+		return nil
+	})
+
+	prevExec := executor
+	executor = h.exec
+	t.Cleanup(func() { executor = prevExec })
+	t.Cleanup(maestro.SetCLI(maestro.ExecCLI{Exec: h.exec}))
+	return h
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (h *harness) args(extra ...string) []string {
+	return append([]string{"--team-id", "TEAM123456", "--driver-host-port", strconv.Itoa(h.port)}, extra...)
+}
+
+func (h *harness) countCalls(sub string) int {
+	n := 0
+	for _, c := range h.exec.Calls() {
+		if strings.Contains(c.String(), sub) {
+			n++
+		}
+	}
+	return n
+}
+
+// bridgeUntilReady runs the bridge, waits until it is registered and the
+// driver answers through it, then stops it.
+func (h *harness) bridgeUntilReady(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- runBridges(ctx, h.args()) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if e, ok := registry.Lookup(testUDID); ok && e.Port == h.port {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("runBridges() returned before ready: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("bridge never became ready")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if _, err := portforward.Probe(ctx, h.port); err != nil {
+		t.Fatalf("driver not reachable through bridge: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runBridges() = %v, want nil after Ctrl+C", err)
+	}
+	if _, ok := registry.Lookup(testUDID); ok {
+		t.Error("bridge still registered after stop")
+	}
+}
+
+func TestRunBridges(t *testing.T) {
+	h := newHarness(t)
+
+	h.bridgeUntilReady(t)
+	if n := h.countCalls("build-for-testing"); n != 1 {
+		t.Errorf("build-for-testing ran %d times, want 1", n)
+	}
+	if n := h.countCalls("DEVELOPMENT_TEAM=TEAM123456"); n != 1 {
+		t.Error("build did not sign with the given team")
+	}
+	if n := h.countCalls("test-without-building -xctestrun"); n != 1 {
+		t.Errorf("test-without-building ran %d times, want 1", n)
+	}
+	if n := h.countCalls("-destination id=" + testUDID); n != 1 {
+		t.Error("runner was not started on the device")
+	}
+
+	// The second run reuses the cached build
+	h.bridgeUntilReady(t)
+	if n := h.countCalls("build-for-testing"); n != 1 {
+		t.Errorf("build-for-testing ran %d times after a cache hit, want 1", n)
+	}
+}
+
+func TestRunBridges_Failures(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(h *harness)
+		wantExit int
+		wantDiag diagnose.Code
+	}{
+		{"not patched", func(h *harness) {
+			h.exec.Handle("maestro", execx.Print("Usage: maestro [options]\n"))
+		}, exitNotPatched, ""},
+		{"no device", func(h *harness) {
+			h.devices.Set()
+		}, exitNoDevice, ""},
+		{"unknown device", func(h *harness) {
+			h.devices.Set(device.Device{Serial: "00008101-AAAA", Name: "Other", Paired: true})
+		}, exitNoDevice, ""},
+		{"build fails", func(h *harness) {
+			h.exec.Handle("xcodebuild", func(ctx context.Context, args []string, out io.Writer) error {
+				if args[0] == "-version" {
+					fmt.Fprintln(out, "Xcode 16.2")
+					return nil
+				}
+				fmt.Fprintln(out, `error: No Account for Team "TEAM123456". Add a new account in Accounts settings or verify that your accounts have valid credentials.`)
+				fmt.Fprintln(out, "** TEST BUILD FAILED **")
+				return errors.New("exit status 65")
+			})
+		}, exitBuild, diagnose.NoSigningCert},
+		{"runner fails", func(h *harness) {
+			h.exec.Handle("xcodebuild", func(ctx context.Context, args []string, out io.Writer) error {
+				switch args[0] {
+				case "-version":
+					fmt.Fprintln(out, "Xcode 16.2")
+				case "build-for-testing":
+					products := filepath.Join(execx.Arg(args, "-derivedDataPath"), "Build", "Products")
+					os.MkdirAll(products, 0755)
+					return os.WriteFile(filepath.Join(products, "maestro-driver-ios_iphoneos18.2-arm64.xctestrun"), nil, 0644)
+				default:
+					fmt.Fprintln(out, "Testing failed:")
+					fmt.Fprintln(out, "\tUnable to launch com.devicelab.xctrunner because the device was not, or could not be, unlocked.")
+					fmt.Fprintln(out, "\n** TEST EXECUTE FAILED **")
+					return errors.New("exit status 65")
+				}
+				return nil
+			})
+		}, exitRunner, diagnose.DeviceLocked},
+		{"port in use", func(h *harness) {
+			ln, err := net.Listen("tcp", fmt.Sprintf(":%d", h.port))
+			if err == nil {
+				t.Cleanup(func() { ln.Close() })
+			}
+		}, exitPortForward, ""},
+		{"bad flag", nil, exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			args := h.args("--device", testUDID)
+			if tt.setup != nil {
+				tt.setup(h)
+			} else {
+				args = append(args, "--no-such-flag")
+			}
+
+			err := runBridges(context.Background(), args)
+			if got := exitCode(err); got != tt.wantExit {
+				t.Fatalf("exitCode = %d, want %d (err: %v)", got, tt.wantExit, err)
+			}
+			if tt.wantDiag != "" && diagnose.CodeOf(err) != tt.wantDiag {
+				t.Errorf("diagnosis = %q, want %q (err: %v)", diagnose.CodeOf(err), tt.wantDiag, err)
+			}
+			// The bridges are stopped by now; the log a diagnosis points
+			// to must outlive them
+			var de *diagnose.Error
+			if errors.As(err, &de) && de.Log != "" {
+				if _, serr := os.Stat(de.Log); serr != nil {
+					t.Errorf("log %s is gone: %v", de.Log, serr)
+				}
+			}
+		})
+	}
+}
+
+// scriptMaestro keeps maestro reporting a patched 2.1.0 and plays run for
+// everything else, i.e. maestro test.
+func (h *harness) scriptMaestro(run execx.Script) {
+	h.exec.Handle("maestro", func(ctx context.Context, args []string, out io.Writer) error {
+		switch args[0] {
+		case "--version":
+			fmt.Fprintln(out, "2.1.0")
+			return nil
+		case "--help":
+			fmt.Fprintln(out, "  --driver-host-port=<port>  Port of the driver")
+			return nil
+		}
+		return run(ctx, args, out)
+	})
+}
+
+// scriptMaestroTest makes maestro test probe the driver on the port it was
+// given, then exit with code.
+func (h *harness) scriptMaestroTest(code int) {
+	h.scriptMaestro(func(ctx context.Context, args []string, out io.Writer) error {
+		port, _ := strconv.Atoi(execx.Arg(args, "--driver-host-port"))
+		if _, err := portforward.Probe(ctx, port); err != nil {
+			return fmt.Errorf("driver unreachable: %w", err)
+		}
+		fmt.Fprintln(out, "Flow passed")
+		if code != 0 {
+			return &execx.ExitError{Code: code}
+		}
+		return nil
+	})
+}
+
+// scriptMaestroPass makes every flow pass, writing one testcase per flow to
+// --output as maestro does.
+func (h *harness) scriptMaestroPass() {
+	h.scriptMaestro(func(ctx context.Context, args []string, out io.Writer) error {
+		if report := execx.Arg(args, "--output"); report != "" {
+			flow := strings.TrimSuffix(filepath.Base(execx.Arg(args, "test")), ".yaml")
+			os.WriteFile(report, []byte(fmt.Sprintf(`<testsuites><testsuite name="Test Suite"><testcase name=%q time="1.5"/></testsuite></testsuites>`, flow)), 0644)
+		}
+		fmt.Fprintln(out, "Flow passed")
+		return nil
+	})
+}
+
+func TestRunTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		wantExit int
+	}{
+		{"flows pass", 0, 0},
+		{"flows fail", 1, 1},
+		{"maestro errors", 4, exitMaestro},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			h.scriptMaestroTest(tt.code)
+
+			err := runTest(context.Background(), h.args("--app-file", "app.ipa", "flows/", "--format", "junit"))
+			if got := exitCode(err); got != tt.wantExit {
+				t.Fatalf("exitCode = %d, want %d (err: %v)", got, tt.wantExit, err)
+			}
+
+			want := fmt.Sprintf("maestro --driver-host-port %d --device %s --app-file app.ipa test flows/ --format junit", h.port, testUDID)
+			if n := h.countCalls(want); n != 1 {
+				t.Errorf("%q ran %d times, want 1; calls: %v", want, n, h.exec.Calls())
+			}
+			if _, ok := registry.Lookup(testUDID); ok {
+				t.Error("bridge still registered after the run")
+			}
+		})
+	}
+}
+
+func TestRunTest_Usage(t *testing.T) {
+	h := newHarness(t)
+	for _, args := range [][]string{
+		h.args("flows/"),
+		h.args("--app-file", "app.ipa"),
+	} {
+		if err := runTest(context.Background(), args); exitCode(err) != exitUsage {
+			t.Errorf("runTest(%v) = %v, want a usage error", args, err)
+		}
+	}
+}
+
+func TestRunTest_Shard(t *testing.T) {
+	h := newHarness(t)
+	const secondUDID = "00008101-000A1B2C3D4E"
+	h.devices.Set(
+		device.Device{Serial: testUDID, Name: "Test iPhone", OSVersion: "18.2", Paired: true},
+		device.Device{Serial: secondUDID, Name: "Test iPad", OSVersion: "17.5", Paired: true},
+	)
+	h.scriptMaestroPass()
+
+	flows := t.TempDir()
+	for _, name := range []string{"login.yaml", "search.yaml", "checkout.yaml", "config.yaml"} {
+		os.WriteFile(filepath.Join(flows, name), nil, 0644)
+	}
+	report := filepath.Join(t.TempDir(), "out", "report.xml")
+
+	args := append(h.args("--shard", "--device", testUDID, "--device", secondUDID, "--report", report, "--app-file", "app.ipa"), flows)
+	if err := runTest(context.Background(), args); err != nil {
+		t.Fatalf("runTest(--shard) = %v", err)
+	}
+
+	if n := h.countCalls("--format junit --output"); n != 3 {
+		t.Errorf("maestro ran %d flows, want 3 (config.yaml is not a flow)", n)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`tests="3"`, `name="login"`, `name="checkout"`, `value="` + testUDID + `"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("report missing %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestRunTest_DeviceAliases(t *testing.T) {
+	const secondUDID = "00008101-000A1B2C3D4E"
+	tests := []struct {
+		name    string
+		devices []string
+		want    []string
+	}{
+		{"single", []string{"--device", "phone-b"}, []string{secondUDID}},
+		{"repeated", []string{"--shard", "--device", "phone-a", "--device", "phone-b"}, []string{testUDID, secondUDID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			h.devices.Set(
+				device.Device{Serial: testUDID, Name: "Test iPhone", OSVersion: "18.2", Paired: true},
+				device.Device{Serial: secondUDID, Name: "Test iPad", OSVersion: "17.5", Paired: true},
+			)
+			h.scriptMaestroPass()
+			home, _ := os.UserHomeDir()
+			os.WriteFile(filepath.Join(home, config.FileName), []byte("devices:\n  phone-a: "+testUDID+"\n  phone-b: "+secondUDID+"\n"), 0644)
+
+			flows := t.TempDir()
+			os.WriteFile(filepath.Join(flows, "login.yaml"), nil, 0644)
+			os.WriteFile(filepath.Join(flows, "search.yaml"), nil, 0644)
+
+			report := filepath.Join(t.TempDir(), "report.xml")
+			args := append(h.args(tt.devices...), "--report", report, "--app-file", "app.ipa", flows)
+			if err := runTest(context.Background(), args); err != nil {
+				t.Fatalf("runTest(%v) = %v", tt.devices, err)
+			}
+			for _, udid := range tt.want {
+				if h.countCalls("-destination id="+udid) == 0 {
+					t.Errorf("no runner started on %s; calls: %v", udid, h.exec.Calls())
+				}
+			}
+		})
+	}
+}
+
+func TestRunTest_Retries(t *testing.T) {
+	h := newHarness(t)
+	var mu sync.Mutex
+	failures := map[string]int{"flaky": 1, "broken": 3}
+	h.scriptMaestro(func(ctx context.Context, args []string, out io.Writer) error {
+		flow := strings.TrimSuffix(filepath.Base(execx.Arg(args, "test")), ".yaml")
+		mu.Lock()
+		fail := failures[flow] > 0
+		failures[flow]--
+		mu.Unlock()
+
+		status := `<testcase name="` + flow + `"/>`
+		if fail {
+			status = `<testcase name="` + flow + `"><failure>Element not found</failure></testcase>`
+		}
+		os.WriteFile(execx.Arg(args, "--output"), []byte(`<testsuites><testsuite name="Test Suite">`+status+`</testsuite></testsuites>`), 0644)
+		if fail {
+			return &execx.ExitError{Code: 1}
+		}
+		return nil
+	})
+
+	flows := t.TempDir()
+	for _, name := range []string{"flaky.yaml", "broken.yaml", "fine.yaml"} {
+		os.WriteFile(filepath.Join(flows, name), nil, 0644)
+	}
+	report := filepath.Join(t.TempDir(), "report.xml")
+
+	err := runTest(context.Background(), append(h.args("--retries", "2", "--report", report, "--app-file", "app.ipa"), flows))
+	if got := exitCode(err); got != 1 {
+		t.Fatalf("exitCode = %d, want 1 for the broken flow (err: %v)", got, err)
+	}
+
+	// 1 + 2 flaky, 3 broken, 1 fine; a fresh runner before each of the 3 retries
+	if n := h.countCalls("--format junit"); n != 6 {
+		t.Errorf("maestro ran %d times, want 6", n)
+	}
+	if n := h.countCalls("test-without-building"); n != 4 {
+		t.Errorf("runner started %d times, want 4", n)
+	}
+
+	cases, err := shard.ReadCases(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]shard.Case)
+	for _, c := range cases {
+		byName[c.Name] = c
+	}
+	if c := byName["flaky"]; c.Failure != nil || len(c.FlakyFailures) != 1 {
+		t.Errorf("flaky = %+v, want passed with one flakyFailure", c)
+	}
+	if c := byName["broken"]; c.Failure == nil || len(c.RerunFailures) != 2 {
+		t.Errorf("broken = %+v, want failed with two rerunFailures", c)
+	}
+
+	// Each failed attempt ran on its own runner and keeps its log
+	logs := make(map[string]bool)
+	for _, p := range byName["broken"].Properties {
+		if strings.HasSuffix(p.Name, ".runner.log") {
+			if _, err := os.Stat(p.Value); err != nil {
+				t.Errorf("%s: %v", p.Name, err)
+			}
+			logs[p.Value] = true
+		}
+	}
+	if len(logs) != 3 {
+		t.Errorf("broken kept %d runner logs, want one per attempt: %v", len(logs), logs)
+	}
+	if c := byName["fine"]; c.Failure != nil || len(c.FlakyFailures) != 0 {
+		t.Errorf("fine = %+v, want a plain pass", c)
+	}
+}
+
+func TestRunTest_DriverBlip(t *testing.T) {
+	h := newHarness(t)
+	prev := probeInterval
+	probeInterval = 10 * time.Millisecond
+	t.Cleanup(func() { probeInterval = prev })
+
+	// The driver misses the first probe after the flow fails
+	var blip atomic.Int32
+	t.Cleanup(portforward.SetForwarder(fakemac.Driver(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blip.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))))
+	h.scriptMaestro(func(ctx context.Context, args []string, out io.Writer) error {
+		os.WriteFile(execx.Arg(args, "--output"), []byte(`<testsuites><testsuite name="Test Suite"><testcase name="login"><failure>Element not found</failure></testcase></testsuite></testsuites>`), 0644)
+		blip.Store(1)
+		return &execx.ExitError{Code: 1}
+	})
+
+	flows := t.TempDir()
+	os.WriteFile(filepath.Join(flows, "login.yaml"), nil, 0644)
+	report := filepath.Join(t.TempDir(), "report.xml")
+
+	err := runTest(context.Background(), append(h.args("--shard", "--report", report, "--app-file", "app.ipa"), flows))
+	if got := exitCode(err); got != 1 {
+		t.Fatalf("exitCode = %d, want 1 for a failed flow, not a lost device (err: %v)", got, err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+)
+
+// selectDevice resolves --device to a single connected device. An empty
+// query picks the only connected device, or asks on a terminal when several
+// are attached. Queries may be a full UDID, a UDID prefix or a device name.
+func selectDevice(query string) (*device.Device, error) {
+	list, err := device.List()
+	if err != nil {
+		if query != "" {
+			// Fall back to a direct lookup by UDID
+			return device.Get(query)
+		}
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	candidates := list
+	if query != "" {
+		candidates = device.Match(list, query)
+	}
+
+	switch {
+	case len(candidates) == 1:
+		d := candidates[0]
+		if query != d.Serial {
+			fmt.Printf("📱 Selected %s (%s)\n", d.Name, d.Serial)
+		}
+		return &d, nil
+	case len(candidates) == 0 && query == "":
+		return nil, fmt.Errorf("%w. Connect an iOS device via USB", device.ErrNoDevices)
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("%w: %s. Connected devices:\n%s", device.ErrNotFound, query, formatDevices(list))
+	}
+
+	if isTerminal(os.Stdin) {
+		return pickDevice(candidates)
+	}
+	if query == "" {
+		return nil, fmt.Errorf("%w, pass --device:\n%s", device.ErrAmbiguous, formatDevices(candidates))
+	}
+	return nil, fmt.Errorf("%w %q, pass a longer UDID:\n%s", device.ErrAmbiguous, query, formatDevices(candidates))
+}
+
+func pickDevice(candidates []device.Device) (*device.Device, error) {
+	fmt.Println("Multiple devices connected:")
+	for i, d := range candidates {
+		fmt.Printf("  %d) %s (%s) - iOS %s\n", i+1, d.Name, d.Serial, d.OSVersion)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Select device [1-%d]: ", len(candidates))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: none selected", device.ErrNotFound)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(candidates) {
+			fmt.Println()
+			return &candidates[n-1], nil
+		}
+	}
+}
+
+func formatDevices(list []device.Device) string {
+	var b strings.Builder
+	for _, d := range list {
+		fmt.Fprintf(&b, "  %s  %s (iOS %s)\n", d.Serial, d.Name, d.OSVersion)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// selectDevices resolves every --device query, or all paired devices with
+// --all-devices. Without either, it falls back to selectDevice("").
+func selectDevices(queries []string, all bool) ([]device.Device, error) {
+	if all {
+		list, err := device.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices: %w", err)
+		}
+		var paired []device.Device
+		for _, d := range list {
+			if !d.Paired {
+				fmt.Printf("⚠️  Skipping %s (%s): not paired\n", d.Name, d.Serial)
+				continue
+			}
+			paired = append(paired, d)
+		}
+		if len(paired) == 0 {
+			return nil, fmt.Errorf("%w: none are paired", device.ErrNoDevices)
+		}
+		return paired, nil
+	}
+
+	if len(queries) == 0 {
+		queries = []string{""}
+	}
+
+	seen := make(map[string]bool)
+	var devices []device.Device
+	for _, q := range queries {
+		d, err := selectDevice(q)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[d.Serial] {
+			seen[d.Serial] = true
+			devices = append(devices, *d)
+		}
+	}
+	return devices, nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/server"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
+)
+
+const defaultServeAddr = "127.0.0.1:7001"
+
+func serve(args []string) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runServer(ctx, args, nil); err != nil {
+		cancel()
+		fatal("%w", err)
+	}
+}
+
+// runServer serves the control API until ctx is done. ready, if set, gets
+// the address once the server listens.
+func runServer(ctx context.Context, args []string, ready func(addr string)) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", defaultServeAddr, "Address to listen on, host:port or unix:/path/to.sock")
+	fs.String("team-id", "", "Apple Developer Team ID for bridges that do not pass one (default: auto-detect)")
+	maxRestarts := fs.Int("max-restarts", watchdog.DefaultOptions().MaxRestarts, "Restart a crashed or unresponsive runner at most this many times (0 disables)")
+	profile := fs.String("profile", "", "Config profile to use")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	cfg, err := loadConfig(*profile, fs)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := maestro.IsPatched(); !ok {
+		return fmt.Errorf("%w. Run: maestro-ios-device setup", maestro.ErrNotPatched)
+	}
+
+	srv := server.New(ctx, bridge.Options{
+		TeamID:         cfg.String(config.TeamID),
+		CacheDir:       cfg.Path(config.BuildCache),
+		BuildTimeout:   cfg.Duration(config.BuildTimeout),
+		StartupTimeout: cfg.Duration(config.StartupTimeout),
+		MaxRestarts:    *maxRestarts,
+	}, os.Stdout)
+	defer srv.StopAll()
+
+	ln, err := server.Listen(*addr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- httpServer.Serve(ln) }()
+
+	fmt.Printf("🛰️  Serving the bridge API on %s\n", *addr)
+	fmt.Println("Press Ctrl+C to stop.")
+	if ready != nil {
+		ready(ln.Addr().String())
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("\n🛑 Stopping...")
+	case err := <-errc:
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	return nil
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/config"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/shard"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
+)
+
+const testUsage = "maestro-ios-device test [--device UDID]... [--shard] [--retries N] --app-file <app.ipa> <flows>... [maestro test options]"
+
+func test(args []string) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := runTest(ctx, args); err != nil {
+		cancel()
+		fatal("%w", err)
+	}
+}
+
+// testOptions are the parsed test flags shared by both modes.
+type testOptions struct {
+	cfg         *config.Config
+	teamID      string
+	appFile     string
+	maxRestarts int
+	retries     int
+	flows       []string // files or directories
+	maestroArgs []string // passed to maestro test after the flows
+}
+
+// runTest bridges the selected devices, runs maestro test against them and
+// tears the bridges down again. A failed Maestro run returns a *maestroExit.
+func runTest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("team-id", "", "Apple Developer Team ID (default: auto-detect)")
+	var deviceQueries stringList
+	fs.Var(&deviceQueries, "device", "Target device UDID, UDID prefix or name; repeatable with --shard (default: the only connected device)")
+	allDevices := fs.Bool("all-devices", false, "Use every connected device (implies --shard)")
+	useShard := fs.Bool("shard", false, "Spread the flows over all selected devices")
+	retries := fs.Int("retries", 0, "Retry a failed flow up to this many times on a fresh runner (implies running flows one by one)")
+	reportPath := fs.String("report", "report.xml", "Where --shard and --retries write the merged JUnit report")
+	fs.Int("driver-host-port", 0, "Local port (default: auto-assign from 6001)")
+	appFile := fs.String("app-file", "", "App to install and test (.ipa or .app)")
+	maxRestarts := fs.Int("max-restarts", watchdog.DefaultOptions().MaxRestarts, "Restart a crashed or unresponsive runner at most this many times (0 disables)")
+	profile := fs.String("profile", "", "Config profile to use")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	opts := testOptions{appFile: *appFile, maxRestarts: *maxRestarts, retries: *retries}
+	opts.flows, opts.maestroArgs = splitFlows(fs.Args())
+	if opts.appFile == "" || len(opts.flows) == 0 {
+		return fmt.Errorf("%w: %s", errUsage, testUsage)
+	}
+	if len(deviceQueries) > 1 && !*useShard && !*allDevices {
+		return fmt.Errorf("%w: pass --shard to run on several devices", errUsage)
+	}
+	if *retries < 0 {
+		return fmt.Errorf("%w: --retries must be 0 or more", errUsage)
+	}
+	// Retries and sharding both run one maestro test per flow
+	*useShard = *useShard || *allDevices || *retries > 0
+	if *useShard && (hasFlag(opts.maestroArgs, "--format") || hasFlag(opts.maestroArgs, "--output")) {
+		return fmt.Errorf("%w: --shard and --retries set maestro's --format and --output; use --report", errUsage)
+	}
+
+	printBanner()
+
+	var err error
+	if opts.cfg, err = loadConfig(*profile, fs); err != nil {
+		return err
+	}
+	deviceQueries = resolveDevices(opts.cfg, deviceQueries)
+
+	if ok, _ := maestro.IsPatched(); !ok {
+		return fmt.Errorf("%w. Run: maestro-ios-device setup", maestro.ErrNotPatched)
+	}
+	if opts.teamID, err = resolveTeam(opts.cfg.String(config.TeamID)); err != nil {
+		return err
+	}
+
+	if *useShard {
+		return runShard(ctx, opts, deviceQueries, *allDevices, *reportPath)
+	}
+	return runSingle(ctx, opts, firstOrEmpty(deviceQueries))
+}
+
+func runSingle(ctx context.Context, opts testOptions, query string) error {
+	dev, err := selectDevice(query)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📱 %s (%s) - iOS %s\n\n", dev.Name, dev.Serial, dev.OSVersion)
+
+	b, err := bridge.New(opts.bridgeOptions(dev.Serial, opts.cfg.Int(config.Port)))
+	if err != nil {
+		return err
+	}
+	defer b.Stop()
+
+	if err := b.Start(ctx); err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("\n🛑 Stopping...")
+			return nil
+		}
+		return err
+	}
+
+	maestroArgs := append(maestroTestArgs(b, opts.appFile), opts.flows...)
+	maestroArgs = append(maestroArgs, opts.maestroArgs...)
+	fmt.Printf("\n▶️  maestro %s\n\n", joinArgs(maestroArgs))
+
+	err = execx.Run(ctx, executor, os.Stdout, "maestro", maestroArgs...)
+	if ctx.Err() != nil {
+		fmt.Println("\n🛑 Stopping...")
+		return nil
+	}
+	if code, ok := execx.ExitCode(err); ok {
+		return &maestroExit{code}
+	}
+	if err != nil {
+		return fmt.Errorf("could not run maestro: %w", err)
+	}
+	fmt.Println("\n✅ Maestro passed")
+	return nil
+}
+
+// runShard bridges every selected device and hands the flows out one at a
+// time to whichever is free, retrying failed ones on a fresh runner, then
+// merges their JUnit reports.
+func runShard(ctx context.Context, opts testOptions, queries []string, all bool, reportPath string) error {
+	flows, err := shard.Discover(opts.flows)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	devs, err := selectDevices(queries, all)
+	if err != nil {
+		return err
+	}
+	ports, err := utils.ResolvePorts(opts.cfg.Int(config.Port), len(devs))
+	if err != nil {
+		return err
+	}
+
+	bridges := make([]*bridge.Bridge, len(devs))
+	for i, d := range devs {
+		fmt.Printf("📱 %s (%s) - iOS %s\n", d.Name, d.Serial, d.OSVersion)
+		bo := opts.bridgeOptions(d.Serial, ports[i])
+		bo.LogPrefix = fmt.Sprintf("[%s] ", utils.ShortUDID(d.Serial))
+		if bridges[i], err = bridge.New(bo); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+
+	startBridges(ctx, bridges)
+	defer stopBridges(bridges)
+	if ctx.Err() != nil {
+		fmt.Println("\n🛑 Stopping...")
+		return nil
+	}
+
+	workDir, err := os.MkdirTemp("", "maestro-shard-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	var out sync.Mutex
+	var workers []shard.Worker
+	labels := make(map[string]string)
+	for _, b := range bridges {
+		d := b.Device()
+		labels[d.UDID] = fmt.Sprintf("%s (%s)", d.Name, d.UDID)
+		if b.Err() != nil {
+			continue
+		}
+		workers = append(workers, &shardWorker{
+			b:      b,
+			opts:   opts,
+			dir:    workDir,
+			logDir: strings.TrimSuffix(reportPath, filepath.Ext(reportPath)) + "-logs",
+			out:    &prefixWriter{prefix: fmt.Sprintf("[%s] ", utils.ShortUDID(d.UDID)), w: os.Stdout, mu: &out},
+			label:  labels[d.UDID],
+		})
+	}
+	fmt.Println()
+	printSummary(bridges)
+	if len(workers) == 0 {
+		return noneBridged(bridges)
+	}
+	fmt.Printf("\n▶️  Running %d flow(s) on %d device(s)\n\n", len(flows), len(workers))
+
+	results := shard.Run(ctx, workers, flows, opts.retries)
+	if ctx.Err() != nil {
+		fmt.Println("\n🛑 Stopping...")
+		return nil
+	}
+
+	if err := writeReport(reportPath, shard.Merge(results, labels)); err != nil {
+		return err
+	}
+	return printShardResults(results, labels, reportPath)
+}
+
+func (o testOptions) bridgeOptions(udid string, port int) bridge.Options {
+	return bridge.Options{
+		UDID:           udid,
+		TeamID:         o.teamID,
+		Port:           port,
+		CacheDir:       o.cfg.Path(config.BuildCache),
+		BuildTimeout:   o.cfg.Duration(config.BuildTimeout),
+		StartupTimeout: o.cfg.Duration(config.StartupTimeout),
+		MaxRestarts:    o.maxRestarts,
+	}
+}
+
+// maestroTestArgs points maestro test at b; flows and options follow.
+func maestroTestArgs(b *bridge.Bridge, appFile string) []string {
+	return []string{
+		"--driver-host-port", strconv.Itoa(b.Port()),
+		"--device", b.Device().UDID,
+		"--app-file", appFile,
+		"test",
+	}
+}
+
+// shardWorker runs flows on one bridged device, one maestro test each.
+type shardWorker struct {
+	b    *bridge.Bridge
+	opts testOptions
+	dir  string
+	// logDir keeps the runner logs of failed attempts past the bridge
+	logDir string
+	out    *prefixWriter
+	label  string
+	runs   int
+}
+
+func (w *shardWorker) Name() string {
+	return w.b.Device().UDID
+}
+
+func (w *shardWorker) Run(ctx context.Context, flow string) shard.Attempt {
+	if err := w.lost(ctx); err != nil {
+		return shard.Attempt{Outcome: shard.DeviceLost, Err: err}
+	}
+
+	w.runs++
+	report := filepath.Join(w.dir, fmt.Sprintf("%s-%03d.xml", w.Name(), w.runs))
+	args := append(maestroTestArgs(w.b, w.opts.appFile), flow, "--format", "junit", "--output", report)
+	args = append(args, w.opts.maestroArgs...)
+	fmt.Fprintf(w.out, "▶️  %s\n", flow)
+
+	err := execx.Run(ctx, executor, w.out, "maestro", args...)
+	w.out.Flush()
+	switch {
+	case err == nil:
+		return shard.Attempt{Outcome: shard.Passed, Report: report}
+	case ctx.Err() != nil:
+		return shard.Attempt{Outcome: shard.NotRun, Err: ctx.Err()}
+	}
+
+	// A dead device fails every flow; don't blame this one. A runner that
+	// wedged mid-flow is back once lost returns, restarted by the watchdog.
+	if lost := w.lost(ctx); lost != nil {
+		if ctx.Err() != nil {
+			return shard.Attempt{Outcome: shard.NotRun, Err: ctx.Err()}
+		}
+		w.b.Logf("⚠️  %s lost (%s); its flows go to the other devices", w.label, lost)
+		return shard.Attempt{Outcome: shard.DeviceLost, Err: lost}
+	}
+	if code, ok := execx.ExitCode(err); ok {
+		return shard.Attempt{Outcome: shard.Failed, Report: report, Log: w.keepLog(), Err: &maestroExit{code}}
+	}
+	return shard.Attempt{Outcome: shard.Failed, Err: fmt.Errorf("could not run maestro: %w", err)}
+}
+
+// keepLog copies the runner's log to logDir, since a retry starts a new one
+// and the bridge removes its logs when it stops. It returns the copy's path,
+// or "" if there is none.
+func (w *shardWorker) keepLog() string {
+	src := w.b.LogPath()
+	if src == "" {
+		return ""
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return ""
+	}
+	dst := filepath.Join(w.logDir, fmt.Sprintf("%s-%03d.runner.log", w.Name(), w.runs))
+	if err := os.MkdirAll(w.logDir, 0755); err != nil {
+		return ""
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return ""
+	}
+	return dst
+}
+
+// Reset restarts the runner from the existing build before a retry.
+func (w *shardWorker) Reset(ctx context.Context) error {
+	fmt.Fprintf(w.out, "🔁 Retrying on a fresh runner\n")
+	return w.b.Restart(ctx)
+}
+
+// gone reports whether the bridge is down for good.
+func (w *shardWorker) gone() bool {
+	select {
+	case <-w.b.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// probeInterval is how often lost checks a driver that did not answer.
+var probeInterval = 2 * time.Second
+
+// lost returns why the device can no longer run flows, or nil. A driver
+// that does not answer is not enough: the watchdog either restarts it or
+// gives up, so lost waits for one or the other.
+func (w *shardWorker) lost(ctx context.Context) error {
+	for waiting := false; ; waiting = true {
+		if w.gone() {
+			if err := w.b.Err(); err != nil {
+				return err
+			}
+			return errors.New("bridge stopped")
+		}
+		_, err := portforward.Probe(ctx, w.b.Port())
+		if err == nil {
+			return nil
+		}
+		if !waiting {
+			w.b.Logf("⏳ Driver not responding (%s); waiting for the watchdog", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.b.Done():
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+func writeReport(path string, report *shard.Suites) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printShardResults(results []shard.Result, labels map[string]string, reportPath string) error {
+	var failed, flaky, notRun int
+	logDir := ""
+	fmt.Println()
+	for _, r := range results {
+		for _, a := range append(r.Previous, r.Attempt) {
+			if a.Log != "" {
+				logDir = filepath.Dir(a.Log)
+			}
+		}
+		switch r.Outcome {
+		case shard.Passed:
+			fmt.Printf("✅ %s — %s\n", r.Flow, labels[r.Worker])
+		case shard.Flaky:
+			flaky++
+			fmt.Printf("🔁 %s — %s: flaky, passed on attempt %d\n", r.Flow, labels[r.Worker], len(r.Previous)+1)
+		case shard.Failed:
+			failed++
+			attempts := ""
+			if len(r.Previous) > 0 {
+				attempts = fmt.Sprintf(": failed all %d attempts", len(r.Previous)+1)
+			}
+			fmt.Printf("❌ %s — %s%s\n", r.Flow, labels[r.Worker], attempts)
+		default:
+			notRun++
+			fmt.Printf("⚠️  %s — not run: %s\n", r.Flow, r.Err)
+		}
+	}
+	fmt.Printf("\n📄 JUnit report: %s\n", reportPath)
+	if logDir != "" {
+		fmt.Printf("📄 Runner logs of failed attempts: %s\n", logDir)
+	}
+
+	switch {
+	case notRun > 0:
+		return &summaryError{fmt.Sprintf("%d flow(s) could not run: no healthy device left", notRun), watchdog.ErrGaveUp}
+	case failed > 0:
+		fmt.Printf("\n❌ %d of %d flow(s) failed\n", failed, len(results))
+		return &maestroExit{1}
+	}
+	if flaky > 0 {
+		fmt.Printf("\n✅ All %d flow(s) passed, %d of them only on a retry\n", len(results), flaky)
+		return nil
+	}
+	fmt.Printf("\n✅ All %d flow(s) passed\n", len(results))
+	return nil
+}
+
+// splitFlows separates the leading flow paths from the maestro test options
+// that follow them.
+func splitFlows(args []string) (flows, rest []string) {
+	for i, a := range args {
+		if strings.HasPrefix(a, "-") {
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func firstOrEmpty(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+// prefixWriter prefixes every line, writing whole lines only so output from
+// parallel runs does not interleave mid-line.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.mu.Lock()
+		_, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.mu.Unlock()
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes out a last line that did not end in a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte("\n"))
+	}
+}
+
+// joinArgs formats args for display, quoting the ones with spaces.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t") {
+			a = strconv.Quote(a)
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
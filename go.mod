@@ -2,7 +2,12 @@ module github.com/anthropics/maestro-ios-device
 
 go 1.23.0
 
-require github.com/danielpaulus/go-ios v1.0.131
+require (
+	github.com/danielpaulus/go-ios v1.0.131
+	go.mozilla.org/pkcs7 v0.0.0-20210826202110-33d05740a352
+	gopkg.in/yaml.v3 v3.0.1
+	howett.net/plist v0.0.0-20200419221736-3b63eb3a43b5
+)
 
 require (
 	github.com/Masterminds/semver v1.5.0 // indirect
@@ -11,7 +16,6 @@ require (
 	github.com/grandcat/zeroconf v1.0.0 // indirect
 	github.com/miekg/dns v1.1.57 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
-	go.mozilla.org/pkcs7 v0.0.0-20210826202110-33d05740a352 // indirect
 	golang.org/x/crypto v0.24.0 // indirect
 	golang.org/x/mod v0.17.0 // indirect
 	golang.org/x/net v0.26.0 // indirect
@@ -19,6 +23,5 @@ require (
 	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
-	howett.net/plist v0.0.0-20200419221736-3b63eb3a43b5 // indirect
 	software.sslmate.com/src/go-pkcs12 v0.2.0 // indirect
 )
@@ -0,0 +1,294 @@
+// Package config merges settings from flags, environment variables and
+// .maestro-ios-device.yaml files. Precedence, highest first:
+// flags > env > project file > user file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FileName   = ".maestro-ios-device.yaml"
+	envPrefix  = "MAESTRO_IOS_"
+	envProfile = envPrefix + "PROFILE"
+)
+
+// Setting keys, shared by flags, env vars (MAESTRO_IOS_TEAM_ID, ...) and files.
+const (
+	TeamID         = "team-id"
+	Device         = "device"
+	Port           = "port"
+	BuildCache     = "build-cache"
+	BuildTimeout   = "build-timeout"
+	StartupTimeout = "startup-timeout"
+)
+
+var (
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrInvalid is wrapped as "invalid <key> <value> from <source>".
+	ErrInvalid = errors.New("invalid")
+)
+
+var keys = []string{TeamID, Device, Port, BuildCache, BuildTimeout, StartupTimeout}
+
+// Profile is a set of settings. The top level of a file is itself a profile
+// that named profiles are layered on.
+type Profile struct {
+	TeamID     string   `yaml:"team-id,omitempty"`
+	Device     string   `yaml:"device,omitempty"`
+	Port       int      `yaml:"port,omitempty"`
+	BuildCache string   `yaml:"build-cache,omitempty"`
+	Timeouts   Timeouts `yaml:"timeouts,omitempty"`
+}
+
+type Timeouts struct {
+	Build   time.Duration `yaml:"build,omitempty"`
+	Startup time.Duration `yaml:"startup,omitempty"`
+}
+
+type File struct {
+	Profile        `yaml:",inline"`
+	DefaultProfile string             `yaml:"default-profile,omitempty"`
+	Devices        map[string]string  `yaml:"devices,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+
+	path string
+}
+
+func (p Profile) values() map[string]string {
+	v := map[string]string{
+		TeamID:     p.TeamID,
+		Device:     p.Device,
+		BuildCache: p.BuildCache,
+	}
+	if p.Port != 0 {
+		v[Port] = strconv.Itoa(p.Port)
+	}
+	if p.Timeouts.Build != 0 {
+		v[BuildTimeout] = p.Timeouts.Build.String()
+	}
+	if p.Timeouts.Startup != 0 {
+		v[StartupTimeout] = p.Timeouts.Startup.String()
+	}
+	return v
+}
+
+// Entry is a resolved value and the layer it came from.
+type Entry struct {
+	Value  string
+	Source string
+}
+
+type Config struct {
+	Profile       string
+	ProfileSource string
+	Files         []string
+
+	entries map[string]Entry
+	aliases map[string]Entry
+}
+
+// Options describes the inputs to Load. Flags holds only flags the user set
+// explicitly, keyed by setting name.
+type Options struct {
+	Profile     string
+	Flags       map[string]string
+	Getenv      func(string) string
+	UserFile    string
+	ProjectFile string
+}
+
+// Resolve loads the config for this process: the user file in $HOME, the
+// nearest project file from the working directory up, and the environment.
+func Resolve(profile string, flags map[string]string) (*Config, error) {
+	opts := Options{Profile: profile, Flags: flags, Getenv: os.Getenv}
+	if home, err := os.UserHomeDir(); err == nil {
+		opts.UserFile = filepath.Join(home, FileName)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		opts.ProjectFile = findProjectFile(wd, opts.UserFile)
+	}
+	return Load(opts)
+}
+
+func findProjectFile(dir, userFile string) string {
+	for {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil && path != userFile {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func Load(opts Options) (*Config, error) {
+	if opts.Getenv == nil {
+		opts.Getenv = func(string) string { return "" }
+	}
+
+	var files []*File
+	for _, path := range []string{opts.UserFile, opts.ProjectFile} {
+		if path == "" {
+			continue
+		}
+		f, err := readFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	c := &Config{entries: make(map[string]Entry), aliases: make(map[string]Entry)}
+	for _, f := range files {
+		c.Files = append(c.Files, f.path)
+	}
+
+	// Pick the profile: flag > env > project default > user default
+	c.Profile, c.ProfileSource = opts.Profile, "flag"
+	if c.Profile == "" {
+		c.Profile, c.ProfileSource = opts.Getenv(envProfile), "env "+envProfile
+	}
+	for i := len(files) - 1; i >= 0 && c.Profile == ""; i-- {
+		c.Profile, c.ProfileSource = files[i].DefaultProfile, files[i].path
+	}
+	if c.Profile == "" {
+		c.ProfileSource = ""
+	}
+
+	found := c.Profile == ""
+	for _, f := range files {
+		c.apply(f.Profile.values(), f.path)
+		if p, ok := f.Profiles[c.Profile]; ok && c.Profile != "" {
+			c.apply(p.values(), fmt.Sprintf("%s (profile %s)", f.path, c.Profile))
+			found = true
+		}
+		for alias, udid := range f.Devices {
+			c.aliases[alias] = Entry{udid, f.path}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %q in %s", ErrProfileNotFound, c.Profile, strings.Join(c.Files, ", "))
+	}
+
+	for _, key := range keys {
+		if v := opts.Getenv(EnvVar(key)); v != "" {
+			c.set(key, v, "env "+EnvVar(key))
+		}
+	}
+	c.apply(opts.Flags, "flag")
+
+	if d, ok := c.entries[Device]; ok {
+		if a, ok := c.aliases[d.Value]; ok {
+			c.entries[Device] = Entry{a.Value, fmt.Sprintf("%s (alias %s from %s)", d.Source, d.Value, a.Source)}
+		}
+	}
+
+	return c, c.validate()
+}
+
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.path = path
+	return &f, nil
+}
+
+func (c *Config) apply(values map[string]string, source string) {
+	for _, key := range keys {
+		if v := values[key]; v != "" {
+			c.set(key, v, source)
+		}
+	}
+}
+
+func (c *Config) set(key, value, source string) {
+	c.entries[key] = Entry{value, source}
+}
+
+func (c *Config) validate() error {
+	if e, ok := c.entries[Port]; ok {
+		if p, err := strconv.Atoi(e.Value); err != nil || p < 0 || p > 65535 {
+			return fmt.Errorf("%w %s %q from %s", ErrInvalid, Port, e.Value, e.Source)
+		}
+	}
+	for _, key := range []string{BuildTimeout, StartupTimeout} {
+		if e, ok := c.entries[key]; ok {
+			if _, err := time.ParseDuration(e.Value); err != nil {
+				return fmt.Errorf("%w %s %q from %s", ErrInvalid, key, e.Value, e.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// EnvVar returns the environment variable for a setting, e.g.
+// MAESTRO_IOS_TEAM_ID for team-id.
+func EnvVar(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// Keys returns the setting names in display order.
+func Keys() []string {
+	return append([]string(nil), keys...)
+}
+
+// Lookup returns the resolved entry for key.
+func (c *Config) Lookup(key string) (Entry, bool) {
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// ResolveDevice returns the UDID q is an alias for in the devices: map, or q
+// unchanged when it is not an alias.
+func (c *Config) ResolveDevice(q string) string {
+	if a, ok := c.aliases[q]; ok {
+		return a.Value
+	}
+	return q
+}
+
+func (c *Config) String(key string) string {
+	return c.entries[key].Value
+}
+
+func (c *Config) Int(key string) int {
+	n, _ := strconv.Atoi(c.entries[key].Value)
+	return n
+}
+
+func (c *Config) Duration(key string) time.Duration {
+	d, _ := time.ParseDuration(c.entries[key].Value)
+	return d
+}
+
+// Path returns the value for key with a leading ~ expanded to $HOME.
+func (c *Config) Path(key string) string {
+	v := c.entries[key].Value
+	if v == "~" || strings.HasPrefix(v, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, v[1:])
+		}
+	}
+	return v
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const userYAML = `
+team-id: USERTEAM01
+port: 6100
+devices:
+  iphone: 00008030-001234567890
+profiles:
+  lab:
+    device: iphone
+    timeouts:
+      build: 20m
+`
+
+const projectYAML = `
+default-profile: lab
+build-cache: ~/cache
+profiles:
+  lab:
+    team-id: LABTEAM001
+    port: 6200
+  ci:
+    team-id: CITEAM0001
+`
+
+func writeFiles(t *testing.T) (user, project string) {
+	t.Helper()
+	dir := t.TempDir()
+	user = filepath.Join(dir, "user.yaml")
+	project = filepath.Join(dir, "project.yaml")
+	os.WriteFile(user, []byte(userYAML), 0644)
+	os.WriteFile(project, []byte(projectYAML), 0644)
+	return user, project
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	user, project := writeFiles(t)
+	env := map[string]string{"MAESTRO_IOS_PORT": "6300"}
+
+	c, err := Load(Options{
+		Flags:       map[string]string{StartupTimeout: "2m"},
+		Getenv:      func(k string) string { return env[k] },
+		UserFile:    user,
+		ProjectFile: project,
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if c.Profile != "lab" || c.ProfileSource != project {
+		t.Errorf("profile = %q from %q, want lab from project file", c.Profile, c.ProfileSource)
+	}
+
+	tests := []struct {
+		key, value, source string
+	}{
+		{TeamID, "LABTEAM001", project + " (profile lab)"},
+		{Device, "00008030-001234567890", user + " (profile lab) (alias iphone from " + user + ")"},
+		{Port, "6300", "env MAESTRO_IOS_PORT"},
+		{BuildCache, "~/cache", project},
+		{BuildTimeout, "20m0s", user + " (profile lab)"},
+		{StartupTimeout, "2m", "flag"},
+	}
+	for _, tt := range tests {
+		e, ok := c.Lookup(tt.key)
+		if !ok {
+			t.Errorf("%s not set", tt.key)
+			continue
+		}
+		if e.Value != tt.value || e.Source != tt.source {
+			t.Errorf("%s = %q from %q, want %q from %q", tt.key, e.Value, e.Source, tt.value, tt.source)
+		}
+	}
+
+	if c.Int(Port) != 6300 {
+		t.Errorf("Int(port) = %d, want 6300", c.Int(Port))
+	}
+	if c.Duration(BuildTimeout) != 20*time.Minute {
+		t.Errorf("Duration(build-timeout) = %s, want 20m", c.Duration(BuildTimeout))
+	}
+	home, _ := os.UserHomeDir()
+	if c.Path(BuildCache) != filepath.Join(home, "cache") {
+		t.Errorf("Path(build-cache) = %q", c.Path(BuildCache))
+	}
+}
+
+func TestLoad_ProfileSelection(t *testing.T) {
+	user, project := writeFiles(t)
+
+	c, err := Load(Options{
+		Getenv:      func(k string) string { return map[string]string{envProfile: "ci"}[k] },
+		UserFile:    user,
+		ProjectFile: project,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Profile != "ci" || c.String(TeamID) != "CITEAM0001" || c.String(Port) != "6100" {
+		t.Errorf("unexpected config: profile=%s team=%s port=%s", c.Profile, c.String(TeamID), c.String(Port))
+	}
+
+	if _, err := Load(Options{Profile: "missing", UserFile: user, ProjectFile: project}); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoad_NoFiles(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Load(Options{
+		Flags:       map[string]string{TeamID: "FLAGTEAM01"},
+		UserFile:    filepath.Join(dir, "missing.yaml"),
+		ProjectFile: "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String(TeamID) != "FLAGTEAM01" || len(c.Files) != 0 {
+		t.Errorf("unexpected config: %+v", c)
+	}
+	if _, ok := c.Lookup(Device); ok {
+		t.Error("device should not be set")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []Options{
+		{Flags: map[string]string{Port: "abc"}},
+		{Flags: map[string]string{BuildTimeout: "forever"}},
+	}
+	for _, opts := range tests {
+		if _, err := Load(opts); err == nil {
+			t.Errorf("expected error for %v", opts.Flags)
+		}
+	}
+}
+
+func TestResolveDevice(t *testing.T) {
+	user, _ := writeFiles(t)
+	c, err := Load(Options{UserFile: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ResolveDevice("iphone"); got != "00008030-001234567890" {
+		t.Errorf("ResolveDevice(iphone) = %q", got)
+	}
+	if got := c.ResolveDevice("00008101"); got != "00008101" {
+		t.Errorf("ResolveDevice(00008101) = %q, want it unchanged", got)
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	if got := EnvVar(TeamID); got != "MAESTRO_IOS_TEAM_ID" {
+		t.Errorf("EnvVar(team-id) = %q", got)
+	}
+}
@@ -1,28 +1,80 @@
 package device
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	goios "github.com/danielpaulus/go-ios/ios"
 )
 
+var (
+	ErrNotFound  = errors.New("device not found")
+	ErrNoDevices = errors.New("no devices connected")
+	ErrAmbiguous = errors.New("multiple devices match")
+)
+
 type Device struct {
 	Serial      string
 	Name        string
 	OSVersion   string
 	ProductType string
+	Paired      bool // lockdown answered, i.e. the device trusts this host
 	Entry       goios.DeviceEntry
 }
 
+// Provider finds connected devices.
+type Provider interface {
+	List() ([]Device, error)
+	Get(udid string) (*Device, error)
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = usbmux{}
+)
+
+// SetProvider replaces where devices come from, e.g. with a Fake, and
+// returns a func that restores the previous provider.
+func SetProvider(p Provider) (restore func()) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	prev := provider
+	provider = p
+	return func() {
+		providerMu.Lock()
+		defer providerMu.Unlock()
+		provider = prev
+	}
+}
+
+func current() Provider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
 func Get(udid string) (*Device, error) {
+	return current().Get(udid)
+}
+
+func List() ([]Device, error) {
+	return current().List()
+}
+
+// usbmux asks usbmuxd through go-ios.
+type usbmux struct{}
+
+func (usbmux) Get(udid string) (*Device, error) {
 	entry, err := goios.GetDevice(udid)
 	if err != nil {
-		return nil, fmt.Errorf("device %s not found", udid)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, udid)
 	}
 	return newDevice(udid, entry), nil
 }
 
-func List() ([]Device, error) {
+func (usbmux) List() ([]Device, error) {
 	list, err := goios.ListDevices()
 	if err != nil {
 		return nil, err
@@ -50,7 +102,27 @@ func newDevice(serial string, entry goios.DeviceEntry) *Device {
 		}
 		d.OSVersion = values.Value.ProductVersion
 		d.ProductType = values.Value.ProductType
+		d.Paired = true
 	}
 
 	return d
 }
+
+// Match returns the devices matching query. An exact UDID wins; otherwise
+// devices whose UDID starts with query or whose name equals it (ignoring
+// case) are returned.
+func Match(devices []Device, query string) []Device {
+	for _, d := range devices {
+		if d.Serial == query {
+			return []Device{d}
+		}
+	}
+
+	var matches []Device
+	for _, d := range devices {
+		if strings.HasPrefix(strings.ToLower(d.Serial), strings.ToLower(query)) || strings.EqualFold(d.Name, query) {
+			matches = append(matches, d)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,40 @@
+package device
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	devices := []Device{
+		{Serial: "00008030-001234567890", Name: "Jane's iPhone"},
+		{Serial: "00008030-00ABCDEF0000", Name: "iPad"},
+		{Serial: "00008101-001111111111", Name: "iPad"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"00008030-001234567890", []string{"00008030-001234567890"}},
+		{"00008030-0012", []string{"00008030-001234567890"}},
+		{"00008030", []string{"00008030-001234567890", "00008030-00ABCDEF0000"}},
+		{"00008030-00abc", []string{"00008030-00ABCDEF0000"}},
+		{"jane's iphone", []string{"00008030-001234567890"}},
+		{"iPad", []string{"00008030-00ABCDEF0000", "00008101-001111111111"}},
+		{"unknown", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := Match(devices, tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Match(%q) returned %d devices, want %d", tt.query, len(got), len(tt.want))
+			}
+			for i, d := range got {
+				if d.Serial != tt.want[i] {
+					t.Errorf("Match(%q)[%d] = %s, want %s", tt.query, i, d.Serial, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package device
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Fake is a Provider with a canned device list.
+type Fake struct {
+	mu      sync.Mutex
+	devices []Device
+	err     error
+}
+
+func NewFake(devices ...Device) *Fake {
+	return &Fake{devices: devices}
+}
+
+// Set replaces the connected devices, e.g. to simulate unplugging one.
+func (f *Fake) Set(devices ...Device) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = devices
+}
+
+// Fail makes List fail with err, as when usbmuxd is unreachable.
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *Fake) List() ([]Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]Device(nil), f.devices...), nil
+}
+
+func (f *Fake) Get(udid string) (*Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.devices {
+		if d.Serial == udid {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, udid)
+}
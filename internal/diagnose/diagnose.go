@@ -0,0 +1,177 @@
+// Package diagnose recognises known xcodebuild and runner failures and turns
+// them into errors with a stable code, a cause and a fix.
+package diagnose
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Code identifies a failure. Codes are stable so scripts can branch on them.
+type Code string
+
+const (
+	CertUntrusted    Code = "CERT_UNTRUSTED"
+	DeviceLocked     Code = "DEVICE_LOCKED"
+	DeveloperModeOff Code = "DEVELOPER_MODE_OFF"
+	DeviceNotPaired  Code = "DEVICE_NOT_PAIRED"
+	DeviceNotFound   Code = "DEVICE_NOT_FOUND"
+	ProfileMissing   Code = "PROFILE_MISSING_DEVICE"
+	NoSigningCert    Code = "NO_SIGNING_CERT"
+	DDINotMounted    Code = "DDI_NOT_MOUNTED"
+	IOSTooNew        Code = "IOS_TOO_NEW"
+	KeychainLocked   Code = "KEYCHAIN_LOCKED"
+	BuildFailed      Code = "BUILD_FAILED"
+	BuildTimeout     Code = "BUILD_TIMEOUT"
+	RunnerFailed     Code = "RUNNER_FAILED"
+	RunnerExited     Code = "RUNNER_EXITED"
+	StartupTimeout   Code = "STARTUP_TIMEOUT"
+	DriverTestFailed Code = "DRIVER_TEST_FAILED"
+)
+
+// Signature maps a log pattern to a known failure.
+type Signature struct {
+	Code    Code
+	Pattern *regexp.Regexp
+	Cause   string
+	Fix     string
+}
+
+var (
+	mu sync.RWMutex
+	// catalog is checked in order; the first match wins, so specific
+	// signatures go before broad ones.
+	catalog = []Signature{
+		{
+			Code:    CertUntrusted,
+			Pattern: regexp.MustCompile(`Developer App Certificate is not trusted|has not been explicitly trusted by the user`),
+			Cause:   "The developer certificate is not trusted on the device",
+			Fix:     "On the device: Settings > General > VPN & Device Management > trust your developer certificate",
+		},
+		{
+			Code:    KeychainLocked,
+			Pattern: regexp.MustCompile(`errSecInteractionNotAllowed|User interaction is not allowed|(?i)keychain is locked`),
+			Cause:   "The login keychain is locked, so codesign cannot use the signing key (common over SSH)",
+			Fix:     "Run: security unlock-keychain ~/Library/Keychains/login.keychain-db",
+		},
+		{
+			Code:    DeveloperModeOff,
+			Pattern: regexp.MustCompile(`(?i)developer mode (is )?(disabled|not enabled|off)|enable developer mode`),
+			Cause:   "Developer Mode is off on the device",
+			Fix:     "On the device: Settings > Privacy & Security > Developer Mode > On, then restart it",
+		},
+		{
+			Code:    DeviceLocked,
+			Pattern: regexp.MustCompile(`(?i)device (was not, or could not be, )?unlocked|device is (passcode )?locked|passcode protected`),
+			Cause:   "The device is locked",
+			Fix:     "Unlock the device and keep it awake (Settings > Display & Brightness > Auto-Lock > Never)",
+		},
+		{
+			Code:    DeviceNotPaired,
+			Pattern: regexp.MustCompile(`(?i)(device is )?not paired|pairing (with the device )?(failed|is required)|could not pair|InvalidHostID`),
+			Cause:   "The device is not paired with this Mac",
+			Fix:     "Unlock the device, reconnect it and tap Trust on the \"Trust This Computer?\" prompt",
+		},
+		{
+			Code:    ProfileMissing,
+			Pattern: regexp.MustCompile(`(?i)provisioning profile .*doesn't include (the currently selected|this) device|doesn't include the device|No profiles for '[^']+' were found`),
+			Cause:   "No provisioning profile covers this device",
+			Fix:     "Register the device in your Apple Developer account, or open the runner project in Xcode once with automatic signing to refresh profiles",
+		},
+		{
+			Code:    NoSigningCert,
+			Pattern: regexp.MustCompile(`(?i)No signing certificate .* found|No Account for Team|No "(iOS|Apple) Development" signing certificate|signing certificate matching team ID`),
+			Cause:   "No signing certificate for the team is available",
+			Fix:     "Sign in under Xcode > Settings > Accounts and download the development certificate, or check --team-id",
+		},
+		{
+			Code:    IOSTooNew,
+			Pattern: regexp.MustCompile(`(?i)(iOS|platform) [\d.]+ is not (installed|supported)|not supported by this version of Xcode|Could not locate device support files|Xcode doesn't support iOS`),
+			Cause:   "This Xcode does not support the device's iOS version",
+			Fix:     "Update Xcode, or install the matching platform under Xcode > Settings > Platforms",
+		},
+		{
+			Code:    DDINotMounted,
+			Pattern: regexp.MustCompile(`(?i)developer disk image|\bDDI\b|failed to mount|could not mount`),
+			Cause:   "The Developer Disk Image is not mounted on the device",
+			Fix:     "Open Xcode > Window > Devices and Simulators with the device connected and wait until it is ready",
+		},
+		{
+			Code:    DeviceNotFound,
+			Pattern: regexp.MustCompile(`Unable to find a destination matching|(?i)device .* (not found|disconnected)`),
+			Cause:   "xcodebuild cannot see the device",
+			Fix:     "Check the cable and run: maestro-ios-device devices",
+		},
+	}
+)
+
+// Register adds a signature ahead of the built-in ones.
+func Register(s Signature) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalog = append([]Signature{s}, catalog...)
+}
+
+// Signatures returns the catalog in match order.
+func Signatures() []Signature {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Signature(nil), catalog...)
+}
+
+// Match returns the first signature found in text.
+func Match(text string) (Signature, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, s := range catalog {
+		if s.Pattern.MatchString(text) {
+			return s, true
+		}
+	}
+	return Signature{}, false
+}
+
+// Error is a failure with a code. Detail is the relevant log excerpt and Log
+// the full log's path; both are optional.
+type Error struct {
+	Code   Code
+	Cause  string
+	Fix    string
+	Detail string
+	Log    string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("[" + string(e.Code) + "] " + e.Cause)
+	if e.Fix != "" {
+		b.WriteString("\n   Fix: " + e.Fix)
+	}
+	if d := strings.TrimSpace(e.Detail); d != "" {
+		b.WriteString("\n\n" + d)
+	}
+	if e.Log != "" {
+		b.WriteString("\n\nFull log: " + e.Log)
+	}
+	return b.String()
+}
+
+// Diagnose matches text against the catalog. Without a match it returns a
+// generic error with the fallback code and cause.
+func Diagnose(text string, fallback Code, cause, detail, log string) *Error {
+	if s, ok := Match(text); ok {
+		return &Error{Code: s.Code, Cause: s.Cause, Fix: s.Fix, Detail: detail, Log: log}
+	}
+	return &Error{Code: fallback, Cause: cause, Detail: detail, Log: log}
+}
+
+// CodeOf returns the code carried by err, or "" if it has none.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
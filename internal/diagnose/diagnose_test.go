@@ -0,0 +1,87 @@
+package diagnose
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		log  string
+		want Code
+	}{
+		{"The application could not be launched because the Developer App Certificate is not trusted.", CertUntrusted},
+		{"Unable to launch com.devicelab.maestro-driver-iosUITests.xctrunner because the device was not, or could not be, unlocked.", DeviceLocked},
+		{"Developer Mode disabled. To use iPhone for development, enable Developer Mode in Settings → Privacy & Security.", DeveloperModeOff},
+		{"ERROR: Could not connect to lockdownd: InvalidHostID", DeviceNotPaired},
+		{"The device is not paired with this Mac.", DeviceNotPaired},
+		{`error: Provisioning profile "iOS Team Provisioning Profile: *" doesn't include the currently selected device "iPhone" (identifier 00008030-001234567890).`, ProfileMissing},
+		{`error: No profiles for 'dev.mobile.maestro-driver-iosUITests.xctrunner' were found: Xcode couldn't find any iOS App Development provisioning profiles`, ProfileMissing},
+		{`error: No signing certificate "iOS Development" found: No "iOS Development" signing certificate matching team ID "ABC123XYZ" with a private key was found.`, NoSigningCert},
+		{"error: No Account for Team \"ABC123XYZ\". Add a new account in Accounts settings", NoSigningCert},
+		{"The developer disk image could not be mounted on this device.", DDINotMounted},
+		{"Failed to prepare device for development. Could not locate device support files.", IOSTooNew},
+		{"iOS 18.2 is not installed. To use with Xcode, first download and install the platform", IOSTooNew},
+		{"/usr/bin/codesign --force --sign ... errSecInteractionNotAllowed", KeychainLocked},
+		{"xcodebuild: error: Unable to find a destination matching the provided destination specifier:", DeviceNotFound},
+		{"** BUILD FAILED **", ""},
+	}
+
+	for _, tt := range tests {
+		name := tt.log
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			s, ok := Match(tt.log)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("Match() = %s, want no match", s.Code)
+				}
+				return
+			}
+			if !ok || s.Code != tt.want {
+				t.Errorf("Match() = %q, %v; want %q", s.Code, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogComplete(t *testing.T) {
+	for _, s := range Signatures() {
+		if s.Code == "" || s.Pattern == nil || s.Cause == "" || s.Fix == "" {
+			t.Errorf("incomplete signature: %+v", s)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	saved := Signatures()
+	defer func() { catalog = saved }()
+
+	Register(Signature{Code: "LAB_USB_HUB", Pattern: regexp.MustCompile(`hub reset`), Cause: "USB hub reset", Fix: "Power-cycle the hub"})
+	if s, ok := Match("device not found after hub reset"); !ok || s.Code != "LAB_USB_HUB" {
+		t.Errorf("registered signature should win, got %q", s.Code)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	err := Diagnose("Developer App Certificate is not trusted", RunnerFailed, "runner failed", "tail", "/tmp/runner.log")
+	if err.Code != CertUntrusted || !strings.Contains(err.Error(), "Fix: On the device") || !strings.HasSuffix(err.Error(), "Full log: /tmp/runner.log") {
+		t.Errorf("Diagnose() = %q", err)
+	}
+
+	err = Diagnose("something new", RunnerFailed, "runner failed", "", "")
+	if err.Error() != "[RUNNER_FAILED] runner failed" {
+		t.Errorf("fallback = %q", err)
+	}
+
+	if code := CodeOf(fmt.Errorf("start failed: %w", err)); code != RunnerFailed {
+		t.Errorf("CodeOf(wrapped) = %q", code)
+	}
+	if code := CodeOf(fmt.Errorf("plain")); code != "" {
+		t.Errorf("CodeOf(plain) = %q", code)
+	}
+}
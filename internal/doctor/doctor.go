@@ -0,0 +1,268 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+)
+
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+type Options struct {
+	TeamID string
+	UDID   string
+	Port   int
+}
+
+// Run executes every check in order. Nothing is built or started.
+func Run(opts Options) []Result {
+	var results []Result
+	add := func(r Result) { results = append(results, r) }
+
+	compat, _ := maestro.DefaultCompat()
+
+	version := checkMaestro(add, compat)
+	checkPatched(add)
+	checkLibPath(add)
+	checkRunner(add)
+	checkXcode(add, compat, version)
+	checkSigning(add, opts.TeamID)
+	checkDevices(add, opts.UDID)
+	checkPort(add, opts.Port)
+
+	return results
+}
+
+func checkMaestro(add func(Result), compat *maestro.Compat) string {
+	installed, version, err := maestro.Installed()
+	if err != nil || !installed {
+		add(Result{"Maestro installed", Fail, errMessage(err, "maestro not found in PATH"), "Install Maestro: https://maestro.mobile.dev/"})
+		return ""
+	}
+
+	if _, ok := compat.Lookup(version); !ok {
+		add(Result{"Maestro version", Fail, fmt.Sprintf("%s is not supported (supported: %s)", version, strings.Join(compat.SortedVersions(), ", ")), "Install a supported Maestro version. See: maestro-ios-device compat"})
+		return version
+	}
+	add(Result{"Maestro version", Pass, version, ""})
+	return version
+}
+
+func checkPatched(add func(Result)) {
+	patched, err := maestro.IsPatched()
+	switch {
+	case err != nil:
+		add(Result{"Maestro patched", Fail, err.Error(), "Check that `maestro --help` runs"})
+	case !patched:
+		add(Result{"Maestro patched", Fail, "--driver-host-port not available", "Run: maestro-ios-device setup"})
+	default:
+		add(Result{"Maestro patched", Pass, "--driver-host-port available", ""})
+	}
+}
+
+func checkLibPath(add func(Result)) {
+	libPath, err := maestro.LibPath()
+	if err != nil {
+		add(Result{"Maestro lib", Fail, err.Error(), "Reinstall Maestro so its lib directory sits next to bin/"})
+		return
+	}
+	add(Result{"Maestro lib", Pass, libPath, ""})
+}
+
+func checkRunner(add func(Result)) {
+	path, err := maestro.GetRunnerPath()
+	if err != nil {
+		add(Result{"iOS runner project", Fail, err.Error(), "Run: maestro-ios-device setup"})
+		return
+	}
+	add(Result{"iOS runner project", Pass, path, ""})
+}
+
+// goos is runtime.GOOS; tests pretend to be on a Mac.
+var goos = runtime.GOOS
+
+var (
+	executorMu sync.RWMutex
+	executor   execx.Executor = execx.OS{}
+)
+
+// SetExecutor replaces how checks find xcodebuild, e.g. with an execx.Fake,
+// and returns a func that restores the previous one.
+func SetExecutor(e execx.Executor) (restore func()) {
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	prev := executor
+	executor = e
+	return func() {
+		executorMu.Lock()
+		defer executorMu.Unlock()
+		executor = prev
+	}
+}
+
+func currentExecutor() execx.Executor {
+	executorMu.RLock()
+	defer executorMu.RUnlock()
+	return executor
+}
+
+func checkXcode(add func(Result), compat *maestro.Compat, maestroVersion string) {
+	if goos != "darwin" {
+		add(Result{"xcodebuild", Fail, "macOS is required", "Run on a Mac with Xcode installed"})
+		return
+	}
+	if _, err := currentExecutor().LookPath("xcodebuild"); err != nil {
+		add(Result{"xcodebuild", Fail, "xcodebuild not found", "Install Xcode and run: xcode-select --install"})
+		return
+	}
+	xcode, err := maestro.XcodeVersion()
+	if err != nil || xcode == "" {
+		add(Result{"xcodebuild", Fail, errMessage(err, "could not read Xcode version"), "Accept the license: sudo xcodebuild -license accept"})
+		return
+	}
+
+	if e, ok := compat.Lookup(maestroVersion); ok && e.MinXcode != "" && maestro.CompareVersions(xcode, e.MinXcode) < 0 {
+		add(Result{"xcodebuild", Fail, fmt.Sprintf("Xcode %s (minimum %s)", xcode, e.MinXcode), "Update Xcode from the App Store"})
+		return
+	}
+	add(Result{"xcodebuild", Pass, "Xcode " + xcode, ""})
+}
+
+func checkSigning(add func(Result), teamID string) {
+	teams, err := signing.Teams()
+	if err != nil {
+		add(Result{"Code signing", Fail, err.Error(), "Run on macOS with an unlocked login keychain"})
+		return
+	}
+	if len(teams) == 0 {
+		add(Result{"Code signing", Fail, "no code-signing identity with a Team ID", "Sign in to your Apple ID in Xcode → Settings → Accounts"})
+		return
+	}
+
+	if teamID == "" {
+		team, err := signing.Choose(teams)
+		if err != nil {
+			add(Result{"Code signing", Warn, fmt.Sprintf("%d teams found, --team-id required", len(teams)), "Pass --team-id with one of the teams listed by: security find-identity -v -p codesigning"})
+			return
+		}
+		add(Result{"Code signing", Pass, fmt.Sprintf("team %s auto-detected (%s)", team.ID, team.Identity), ""})
+		return
+	}
+
+	for _, t := range teams {
+		if t.ID == teamID {
+			add(Result{"Code signing", Pass, fmt.Sprintf("team %s (%s)", t.ID, t.Identity), ""})
+			return
+		}
+	}
+	add(Result{"Code signing", Fail, fmt.Sprintf("no signing identity for team %s", teamID), "Check the Team ID in Xcode → Settings → Accounts, or omit --team-id to auto-detect"})
+}
+
+func checkDevices(add func(Result), udid string) {
+	devices, err := device.List()
+	if err != nil {
+		add(Result{"usbmuxd", Fail, err.Error(), "Reconnect the device or restart usbmuxd: sudo killall -9 usbmuxd"})
+		return
+	}
+	add(Result{"usbmuxd", Pass, "reachable", ""})
+
+	if len(devices) == 0 {
+		add(Result{"Devices", Fail, "no devices connected", "Connect an iOS device via USB"})
+		return
+	}
+
+	found := udid == ""
+	for _, d := range devices {
+		if udid != "" && d.Serial != udid {
+			continue
+		}
+		found = true
+		name := fmt.Sprintf("Device %s", d.Serial)
+		if !d.Paired {
+			add(Result{name, Fail, "not paired", "Unlock the device and tap Trust on the \"Trust This Computer?\" prompt"})
+			continue
+		}
+		add(Result{name, Pass, fmt.Sprintf("%s - iOS %s", d.Name, d.OSVersion), ""})
+	}
+	if !found {
+		add(Result{"Device " + udid, Fail, "not connected", "Check the UDID with: maestro-ios-device devices"})
+	}
+}
+
+func checkPort(add func(Result), port int) {
+	p, err := utils.ResolvePort(port)
+	if err != nil {
+		add(Result{"Driver port", Fail, err.Error(), "Free the port or pass --driver-host-port"})
+		return
+	}
+	add(Result{"Driver port", Pass, fmt.Sprintf("%d available", p), ""})
+}
+
+func errMessage(err error, fallback string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fallback
+}
+
+// Failed reports whether any check failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func Print(w io.Writer, results []Result) {
+	icons := map[Status]string{Pass: "✅", Warn: "⚠️ ", Fail: "❌"}
+
+	var failed, warned int
+	for _, r := range results {
+		fmt.Fprintf(w, "%s %-22s %s\n", icons[r.Status], r.Name, r.Message)
+		if r.Hint != "" && r.Status != Pass {
+			fmt.Fprintf(w, "   → %s\n", r.Hint)
+		}
+		switch r.Status {
+		case Fail:
+			failed++
+		case Warn:
+			warned++
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%d checks: %d passed, %d warnings, %d failed\n", len(results), len(results)-failed-warned, warned, failed)
+}
+
+func PrintJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		OK     bool     `json:"ok"`
+		Checks []Result `json:"checks"`
+	}{!Failed(results), results})
+}
@@ -0,0 +1,281 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
+)
+
+func TestFailed(t *testing.T) {
+	if Failed([]Result{{Status: Pass}, {Status: Warn}}) {
+		t.Error("warnings should not fail")
+	}
+	if !Failed([]Result{{Status: Pass}, {Status: Fail}}) {
+		t.Error("expected failure")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	results := []Result{
+		{"Maestro version", Pass, "2.1.0", "ignored"},
+		{"Maestro patched", Fail, "--driver-host-port not available", "Run: maestro-ios-device setup"},
+	}
+
+	var buf bytes.Buffer
+	Print(&buf, results)
+	out := buf.String()
+
+	if strings.Contains(out, "ignored") {
+		t.Error("hints should only be shown for non-passing checks")
+	}
+	if !strings.Contains(out, "→ Run: maestro-ios-device setup") {
+		t.Errorf("missing hint in output:\n%s", out)
+	}
+	if !strings.Contains(out, "2 checks: 1 passed, 0 warnings, 1 failed") {
+		t.Errorf("missing summary in output:\n%s", out)
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PrintJSON(&buf, []Result{{"Driver port", Pass, "6001 available", ""}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		OK     bool
+		Checks []Result
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !got.OK || len(got.Checks) != 1 || got.Checks[0].Status != Pass {
+		t.Errorf("unexpected output: %+v", got)
+	}
+}
+
+// run collects what one check adds.
+func run(check func(add func(Result))) []Result {
+	var results []Result
+	check(func(r Result) { results = append(results, r) })
+	return results
+}
+
+// statuses renders results as "name: status" lines for comparison.
+func statuses(results []Result) string {
+	lines := make([]string, len(results))
+	for i, r := range results {
+		lines[i] = r.Name + ": " + string(r.Status)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fakeMaestro scripts the maestro CLI to report version and, if patched,
+// the --driver-host-port flag.
+func fakeMaestro(t *testing.T, version string, patched bool) {
+	t.Helper()
+	fake := execx.NewFake()
+	if version != "" {
+		fake.Handle("maestro", func(_ context.Context, args []string, out io.Writer) error {
+			switch args[0] {
+			case "--version":
+				fmt.Fprintln(out, version)
+			case "--help":
+				fmt.Fprintln(out, "Usage: maestro [options]")
+				if patched {
+					fmt.Fprintln(out, "  --driver-host-port=<port>")
+				}
+			}
+			return nil
+		})
+	}
+	t.Cleanup(maestro.SetCLI(maestro.ExecCLI{Exec: fake}))
+}
+
+func TestCheckMaestro(t *testing.T) {
+	compat, _ := maestro.LoadCompat("", "")
+
+	tests := []struct {
+		name    string
+		version string
+		patched bool
+		want    string
+	}{
+		{"not installed", "", false, "Maestro installed: fail\nMaestro patched: fail"},
+		{"unsupported", "1.39.0", false, "Maestro version: fail\nMaestro patched: fail"},
+		{"not patched", "2.1.0", false, "Maestro version: pass\nMaestro patched: fail"},
+		{"patched", "2.1.0", true, "Maestro version: pass\nMaestro patched: pass"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeMaestro(t, tt.version, tt.patched)
+			got := run(func(add func(Result)) {
+				checkMaestro(add, compat)
+				checkPatched(add)
+			})
+			if s := statuses(got); s != tt.want {
+				t.Errorf("results:\n%s\nwant:\n%s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRunner(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if got := statuses(run(checkRunner)); got != "iOS runner project: fail" {
+		t.Errorf("without a runner: %s", got)
+	}
+
+	os.MkdirAll(filepath.Join(home, ".maestro", "maestro-ios-xctest-runner", "maestro-driver-ios.xcodeproj"), 0755)
+	if got := statuses(run(checkRunner)); got != "iOS runner project: pass" {
+		t.Errorf("with a runner: %s", got)
+	}
+}
+
+func TestCheckDevices(t *testing.T) {
+	iphone := device.Device{Serial: "00008030-001234567890", Name: "iPhone", OSVersion: "18.2", Paired: true}
+	unpaired := device.Device{Serial: "00008101-AAAA", Name: "iPad", OSVersion: "17.5"}
+
+	tests := []struct {
+		name    string
+		devices []device.Device
+		err     error
+		udid    string
+		want    string
+	}{
+		{"usbmuxd down", nil, errors.New("connection refused"), "", "usbmuxd: fail"},
+		{"none connected", nil, nil, "", "usbmuxd: pass\nDevices: fail"},
+		{"connected", []device.Device{iphone}, nil, "", "usbmuxd: pass\nDevice 00008030-001234567890: pass"},
+		{"not paired", []device.Device{iphone, unpaired}, nil, "", "usbmuxd: pass\nDevice 00008030-001234567890: pass\nDevice 00008101-AAAA: fail"},
+		{"udid selects", []device.Device{iphone, unpaired}, nil, iphone.Serial, "usbmuxd: pass\nDevice 00008030-001234567890: pass"},
+		{"udid not connected", []device.Device{unpaired}, nil, iphone.Serial, "usbmuxd: pass\nDevice 00008030-001234567890: fail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := device.NewFake(tt.devices...)
+			if tt.err != nil {
+				fake.Fail(tt.err)
+			}
+			t.Cleanup(device.SetProvider(fake))
+
+			got := run(func(add func(Result)) { checkDevices(add, tt.udid) })
+			if s := statuses(got); s != tt.want {
+				t.Errorf("results:\n%s\nwant:\n%s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	busy := ln.Addr().(*net.TCPAddr).Port
+
+	if got := statuses(run(func(add func(Result)) { checkPort(add, busy) })); got != "Driver port: fail" {
+		t.Errorf("port in use: %s", got)
+	}
+	if got := statuses(run(func(add func(Result)) { checkPort(add, 0) })); got != "Driver port: pass" {
+		t.Errorf("any free port: %s", got)
+	}
+}
+
+func TestCheckXcode(t *testing.T) {
+	compat := &maestro.Compat{Versions: map[string]maestro.CompatEntry{"2.1.0": {MinXcode: "16.0"}}}
+
+	tests := []struct {
+		name    string
+		goos    string
+		xcode   string
+		status  Status
+		message string
+	}{
+		{"not a Mac", "linux", "", Fail, "macOS is required"},
+		{"not installed", "darwin", "", Fail, "xcodebuild not found"},
+		{"too old", "darwin", "Xcode 15.4\nBuild version 15F31d\n", Fail, "Xcode 15.4 (minimum 16.0)"},
+		{"supported", "darwin", "Xcode 16.2\nBuild version 16C5032a\n", Pass, "Xcode 16.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := goos
+			goos = tt.goos
+			t.Cleanup(func() { goos = prev })
+
+			fake := execx.NewFake()
+			if tt.xcode != "" {
+				fake.SetPath("xcodebuild", "/usr/bin/xcodebuild")
+				fake.Handle("xcodebuild", execx.Print(tt.xcode))
+			}
+			t.Cleanup(SetExecutor(fake))
+			t.Cleanup(maestro.SetCLI(maestro.ExecCLI{Exec: fake}))
+
+			got := run(func(add func(Result)) { checkXcode(add, compat, "2.1.0") })
+			if len(got) != 1 || got[0].Status != tt.status || got[0].Message != tt.message {
+				t.Errorf("results = %+v, want %s %q", got, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestCheckSigning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	identities, _ := os.ReadFile(filepath.Join("..", "signing", "testdata", "find-identity.txt"))
+	certs, _ := os.ReadFile(filepath.Join("..", "signing", "testdata", "certificates.pem"))
+
+	tests := []struct {
+		name       string
+		identities string
+		teamID     string
+		status     Status
+	}{
+		{"no identities", "     0 valid identities found\n", "", Fail},
+		{"several teams", string(identities), "", Warn},
+		{"team given", string(identities), "TEAMBBBBBB", Pass},
+		{"unknown team", string(identities), "TEAMCCCCCC", Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := execx.NewFake()
+			fake.Handle("security", func(_ context.Context, args []string, out io.Writer) error {
+				switch args[0] {
+				case "find-identity":
+					io.WriteString(out, tt.identities)
+				case "find-certificate":
+					out.Write(certs)
+				}
+				return nil
+			})
+			t.Cleanup(signing.SetExecutor(fake))
+
+			got := run(func(add func(Result)) { checkSigning(add, tt.teamID) })
+			if len(got) != 1 || got[0].Status != tt.status {
+				t.Errorf("results = %+v, want %s", got, tt.status)
+			}
+		})
+	}
+
+	t.Run("keychain unreadable", func(t *testing.T) {
+		fake := execx.NewFake()
+		fake.Handle("security", execx.Fail("security: keychain locked\n", 51))
+		t.Cleanup(signing.SetExecutor(fake))
+		if got := statuses(run(func(add func(Result)) { checkSigning(add, "") })); got != "Code signing: fail" {
+			t.Errorf("results: %s", got)
+		}
+	})
+}
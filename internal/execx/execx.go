@@ -0,0 +1,82 @@
+// Package execx runs external commands behind an interface, so code that
+// drives xcodebuild, maestro or security can be tested with scripted fakes.
+package execx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Executor starts external commands.
+type Executor interface {
+	// Start runs name with stdout and stderr written to out. The process is
+	// killed when ctx is done.
+	Start(ctx context.Context, out io.Writer, name string, args ...string) (Process, error)
+	// Output runs name to completion and returns its stdout.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// LookPath resolves name in PATH.
+	LookPath(name string) (string, error)
+}
+
+// Process is a started command.
+type Process interface {
+	Wait() error
+	Kill() error
+}
+
+// Run starts name and waits for it to exit.
+func Run(ctx context.Context, e Executor, out io.Writer, name string, args ...string) error {
+	p, err := e.Start(ctx, out, name, args...)
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+// ExitCode returns the exit status in an error from Wait, if the command
+// ran and exited unsuccessfully.
+func ExitCode(err error) (int, bool) {
+	var e interface{ ExitCode() int }
+	if errors.As(err, &e) {
+		return e.ExitCode(), true
+	}
+	return 0, false
+}
+
+// OS runs real commands.
+type OS struct{}
+
+func (OS) Start(ctx context.Context, out io.Writer, name string, args ...string) (Process, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Don't let a leftover child holding the output pipe block Wait
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return osProcess{cmd}, nil
+}
+
+func (OS) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+func (OS) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+type osProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p osProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p osProcess) Kill() error {
+	return p.cmd.Process.Kill()
+}
@@ -0,0 +1,166 @@
+package execx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Script plays a fake command: it writes output to out and returns the
+// command's exit error. Long-running scripts should return when ctx is done,
+// which is how Kill reaches them.
+type Script func(ctx context.Context, args []string, out io.Writer) error
+
+// Call records one command the code under test ran.
+type Call struct {
+	Name string
+	Args []string
+}
+
+func (c Call) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// Fake is an Executor that runs scripts instead of commands. Commands with
+// no script fail as if they were not installed.
+type Fake struct {
+	mu      sync.Mutex
+	scripts map[string]Script
+	paths   map[string]string
+	calls   []Call
+}
+
+func NewFake() *Fake {
+	return &Fake{scripts: make(map[string]Script), paths: make(map[string]string)}
+}
+
+// Handle scripts name. LookPath finds it at /usr/local/bin/<name>.
+func (f *Fake) Handle(name string, s Script) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[name] = s
+	if _, ok := f.paths[name]; !ok {
+		f.paths[name] = "/usr/local/bin/" + name
+	}
+}
+
+// SetPath sets where LookPath finds name.
+func (f *Fake) SetPath(name, path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths[name] = path
+}
+
+// Calls returns the commands run so far.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+func (f *Fake) script(name string, args []string) (Script, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{name, args})
+	s, ok := f.scripts[name]
+	if !ok {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return s, nil
+}
+
+func (f *Fake) Start(ctx context.Context, out io.Writer, name string, args ...string) (Process, error) {
+	s, err := f.script(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &fakeProcess{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.err = s(ctx, args, out)
+		if p.err == nil && ctx.Err() != nil {
+			p.err = fmt.Errorf("signal: killed")
+		}
+	}()
+	return p, nil
+}
+
+func (f *Fake) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	s, err := f.script(name, args)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = s(ctx, args, &out)
+	return out.Bytes(), err
+}
+
+func (f *Fake) LookPath(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.paths[name]; ok {
+		return p, nil
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+type fakeProcess struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+func (p *fakeProcess) Kill() error {
+	p.cancel()
+	return nil
+}
+
+// Print returns a script that writes text and exits successfully.
+func Print(text string) Script {
+	return func(_ context.Context, _ []string, out io.Writer) error {
+		_, err := io.WriteString(out, text)
+		return err
+	}
+}
+
+// Fail returns a script that writes text and exits with status code.
+func Fail(text string, code int) Script {
+	return func(_ context.Context, _ []string, out io.Writer) error {
+		io.WriteString(out, text)
+		return &ExitError{Code: code}
+	}
+}
+
+// ExitError is a fake command's unsuccessful exit, like *exec.ExitError.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Arg returns the value following flag in args, or "".
+func Arg(args []string, flag string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+// Package fakemac fakes the Mac a bridge runs on: the installed runner
+// project, xcodebuild, one connected iPhone and the XCTest driver behind its
+// forwarded port. Tests of the bridge, the CLI and the server share it, so
+// the whole flow runs on any OS.
+package fakemac
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	goios "github.com/danielpaulus/go-ios/ios"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/runner"
+)
+
+// UDID is the connected iPhone.
+const UDID = "00008030-001234567890"
+
+// RunnerStarted is what xcodebuild prints once the driver is up.
+const RunnerStarted = `Test Suite 'All tests' started at 2024-06-01 10:00:12.004.
+Test Suite 'maestro_driver_iosUITests' started at 2024-06-01 10:00:12.005.
+Test Case '-[maestro_driver_iosUITests.maestro_driver_iosUITests testHttpServer]' started.
+`
+
+type Mac struct {
+	// Exec runs xcodebuild; add scripts for other commands, e.g. maestro.
+	Exec    *execx.Fake
+	Devices *device.Fake
+
+	exitOnce sync.Once
+	exit     chan struct{}
+}
+
+// New installs the runner project under a temp HOME, scripts xcodebuild to
+// build and start the runner, connects the iPhone and answers the driver's
+// /status through every forwarded port. Everything is restored when t ends.
+func New(t testing.TB) *Mac {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	proj := filepath.Join(home, ".maestro", "maestro-ios-xctest-runner", "maestro-driver-ios.xcodeproj")
+	if err := os.MkdirAll(proj, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(proj, "project.pbxproj"), []byte("// runner"), 0644)
+
+	m := &Mac{
+		Exec:    execx.NewFake(),
+		Devices: device.NewFake(device.Device{Serial: UDID, Name: "Test iPhone", OSVersion: "18.2", Paired: true}),
+		exit:    make(chan struct{}),
+	}
+	m.Exec.Handle("xcodebuild", m.xcodebuild)
+
+	t.Cleanup(runner.SetExecutor(m.Exec))
+	t.Cleanup(device.SetProvider(m.Devices))
+	t.Cleanup(portforward.SetForwarder(Driver(nil)))
+	return m
+}
+
+func (m *Mac) xcodebuild(ctx context.Context, args []string, out io.Writer) error {
+	switch args[0] {
+	case "-version":
+		fmt.Fprintln(out, "Xcode 16.2\nBuild version 16C5032a")
+	case "build-for-testing":
+		products := filepath.Join(execx.Arg(args, "-derivedDataPath"), "Build", "Products")
+		os.MkdirAll(products, 0755)
+		if err := os.WriteFile(filepath.Join(products, "maestro-driver-ios_iphoneos18.2-arm64.xctestrun"), nil, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "** TEST BUILD SUCCEEDED **")
+	case "test-without-building":
+		io.WriteString(out, RunnerStarted)
+		select {
+		case <-ctx.Done():
+		case <-m.exit:
+		}
+	}
+	return nil
+}
+
+// ExitRunners makes every runner, running or started later, exit as if the
+// device went away.
+func (m *Mac) ExitRunners() {
+	m.exitOnce.Do(func() { close(m.exit) })
+}
+
+// Driver returns a forwarder that serves h on the local port in place of the
+// tunnel and the XCTest driver behind it. A nil h answers /status with ok.
+func Driver(h http.Handler) portforward.Forwarder {
+	if h == nil {
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"ok"}`))
+		})
+	}
+	return func(_ goios.DeviceEntry, localPort, _ uint16) (io.Closer, error) {
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+		if err != nil {
+			return nil, err
+		}
+		srv := &http.Server{Handler: h}
+		go srv.Serve(ln)
+		return srv, nil
+	}
+}
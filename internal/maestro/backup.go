@@ -0,0 +1,363 @@
+package maestro
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	manifestFile   = "manifest.json"
+	backupIDFormat = "20060102-150405"
+	legacyBackupID = "legacy"
+)
+
+// knownPatchedHashes maps the SHA-256 of every JAR we have shipped to its
+// file name. Backing up one of these would replace the pristine copy with a
+// patched one, so setup refuses to do it.
+var knownPatchedHashes = map[string]string{
+	"d3898ffda5679ee7086e014ba13a4571e2ce764334a5ab3e0c430e7718471367": "maestro-ai.jar",
+	"626cdacd22d10abdd0111e306edfdadf8be0221bda13baa60c1b05764446c275": "maestro-cli-2.0.9.jar",
+	"2fd293a474a7a1a2e086e0501843ef96bf8c60f8085dcc3e72ca2accf833e081": "maestro-cli-2.1.0.jar",
+	"eadcc1803e5322c2f7843e12adf57e0a3cbfa6e8ad021620683f71a134e129fb": "maestro-ios.jar",
+	"94d53524fada2bbb5b2cef34acf2fbecc8cbc63a10c3f7e5d03a208966cbec90": "maestro-orchestra-models.jar",
+	"2b73123e39ddda52c82cbce6597ed43f9a9bbdd4e64022b51812f374f5baec55": "maestro-orchestra.jar",
+	"4d71b0e6c1fe2df464e303f7664c83de5636c1794c093c7ba1221dddfe606243": "maestro-utils.jar",
+	"33a7ef82b39486cad938c09c9bbb9f55ba873c8391ef84c584950989f598cde7": "maestro-web.jar",
+}
+
+type Backup struct {
+	ID             string       `json:"id"`
+	Created        time.Time    `json:"created"`
+	MaestroVersion string       `json:"maestroVersion"`
+	LibPath        string       `json:"libPath"`
+	Files          []BackupFile `json:"files"`
+
+	dir string
+}
+
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (b *Backup) names() []string {
+	names := make([]string, 0, len(b.Files))
+	for _, f := range b.Files {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func (b *Backup) pristine() bool {
+	for _, f := range b.Files {
+		if _, ok := knownPatchedHashes[f.SHA256]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verify checks that every file in the backup still matches its manifest entry.
+func (b *Backup) verify() error {
+	for _, f := range b.Files {
+		sum, size, err := hashFile(filepath.Join(b.dir, f.Name))
+		if err != nil {
+			return err
+		}
+		if size != f.Size || sum != f.SHA256 {
+			return fmt.Errorf("backup %s: %s does not match manifest", b.ID, f.Name)
+		}
+	}
+	return nil
+}
+
+func ListBackups() ([]Backup, error) {
+	root, err := backupBasePath()
+	if err != nil {
+		return nil, err
+	}
+	return listBackups(root)
+}
+
+func RunBackupList() error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups found.")
+		return nil
+	}
+
+	fmt.Printf("%-18s %-20s %-10s %s\n", "ID", "CREATED", "MAESTRO", "FILES")
+	for _, b := range backups {
+		created := "-"
+		if !b.Created.IsZero() {
+			created = b.Created.Local().Format("2006-01-02 15:04:05")
+		}
+		version := b.MaestroVersion
+		if version == "" {
+			version = "unknown"
+		}
+		fmt.Printf("%-18s %-20s %-10s %d\n", b.ID, created, version, len(b.Files))
+	}
+	return nil
+}
+
+func RunBackupRestore(id string) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+
+	for i := range backups {
+		if backups[i].ID == id {
+			return restoreBackup(&backups[i])
+		}
+	}
+	return fmt.Errorf("%w: %s. Run: maestro-ios-device backup list", ErrBackupNotFound, id)
+}
+
+func restoreBackup(b *Backup) error {
+	libPath, err := LibPath()
+	if err != nil {
+		return fmt.Errorf("failed to find Maestro lib: %w", err)
+	}
+
+	if err := b.verify(); err != nil {
+		return err
+	}
+
+	fmt.Printf("📦 Restoring backup %s...\n", b.ID)
+	if err := restoreJars(b.dir, libPath, b.names()); err != nil {
+		return fmt.Errorf("failed to restore JARs: %w", err)
+	}
+	fmt.Println("✅ JARs restored")
+	return nil
+}
+
+// latestBackup returns the newest backup that holds no patched JARs. When
+// version is set, only backups of that Maestro version (or legacy ones,
+// whose version is unknown) are considered.
+func latestBackup(root, version string) (*Backup, error) {
+	backups, err := listBackups(root)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := &backups[i]
+		if version != "" && b.MaestroVersion != "" && b.MaestroVersion != version {
+			continue
+		}
+		if b.pristine() {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("no backup found in %s", root)
+}
+
+// backupJars saves the current Maestro JARs before they are overwritten. If
+// the lib is already patched (setup ran before), the existing pristine
+// backup is kept instead of being replaced by patched copies.
+func backupJars(libPath, version string) error {
+	root, err := backupBasePath()
+	if err != nil {
+		return err
+	}
+
+	patched, err := isLibPatched(libPath)
+	if err != nil {
+		return err
+	}
+	if patched {
+		b, err := latestBackup(root, version)
+		if err != nil {
+			return fmt.Errorf("%w in %s and no original backup exists. Reinstall Maestro and run setup again", ErrAlreadyPatched, libPath)
+		}
+		fmt.Printf("   Maestro already patched, keeping backup %s\n", b.ID)
+		return nil
+	}
+
+	b, err := createBackup(root, libPath, version, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("   Saved backup %s (%d JARs)\n", b.ID, len(b.Files))
+	return nil
+}
+
+// listBackups returns all backups under root, oldest first. JARs copied flat
+// into root by older releases are reported as a single "legacy" backup.
+func listBackups(root string) ([]Backup, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		b, err := readManifest(filepath.Join(root, entry.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, *b)
+	}
+	// IDs sort by time, but a -10 suffix would sort before -2
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.Before(backups[j].Created)
+		}
+		return backups[i].ID < backups[j].ID
+	})
+
+	legacy, err := legacyBackup(root)
+	if err != nil {
+		return nil, err
+	}
+	if legacy != nil {
+		backups = append([]Backup{*legacy}, backups...)
+	}
+	return backups, nil
+}
+
+func readManifest(dir string) (*Backup, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var b Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	b.dir = dir
+	return &b, nil
+}
+
+func legacyBackup(root string) (*Backup, error) {
+	names, err := listJars(root)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	b := &Backup{ID: legacyBackupID, dir: root}
+	for _, name := range names {
+		sum, size, err := hashFile(filepath.Join(root, name))
+		if err != nil {
+			return nil, err
+		}
+		b.Files = append(b.Files, BackupFile{Name: name, Size: size, SHA256: sum})
+	}
+	return b, nil
+}
+
+// createBackup copies the Maestro JARs in libPath into a new timestamped
+// folder under root and writes its manifest. The ID is the UTC time, with a
+// suffix when another backup was taken in the same second.
+func createBackup(root, libPath, version string, now time.Time) (*Backup, error) {
+	names, err := listJars(libPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no Maestro JARs found in %s", libPath)
+	}
+
+	b := &Backup{
+		ID:             now.UTC().Format(backupIDFormat),
+		Created:        now.UTC(),
+		MaestroVersion: version,
+		LibPath:        libPath,
+	}
+	for _, name := range names {
+		sum, size, err := hashFile(filepath.Join(libPath, name))
+		if err != nil {
+			return nil, err
+		}
+		if patched, ok := knownPatchedHashes[sum]; ok {
+			return nil, fmt.Errorf("%s is already patched (matches %s)", name, patched)
+		}
+		b.Files = append(b.Files, BackupFile{Name: name, Size: size, SHA256: sum})
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	// A second backup within the same second gets a -2, -3, ... suffix
+	base := b.ID
+	for n := 2; ; n++ {
+		b.dir = filepath.Join(root, b.ID)
+		err := os.Mkdir(b.dir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		b.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	for _, name := range names {
+		if err := copyFile(filepath.Join(libPath, name), filepath.Join(b.dir, name)); err != nil {
+			os.RemoveAll(b.dir)
+			return nil, fmt.Errorf("failed to backup %s: %w", name, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		os.RemoveAll(b.dir)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(b.dir, manifestFile), data, 0644); err != nil {
+		os.RemoveAll(b.dir)
+		return nil, err
+	}
+	return b, nil
+}
+
+// isLibPatched reports whether any Maestro JAR in libPath is one we shipped.
+func isLibPatched(libPath string) (bool, error) {
+	names, err := listJars(libPath)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		sum, _, err := hashFile(filepath.Join(libPath, name))
+		if err != nil {
+			return false, err
+		}
+		if _, ok := knownPatchedHashes[sum]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
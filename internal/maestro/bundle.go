@@ -0,0 +1,210 @@
+package maestro
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const runnerProject = "maestro-ios-xctest-runner"
+
+// bundle is a staged set of patched JARs and the iOS runner project, ready
+// to be copied into the Maestro installation.
+type bundle struct {
+	jarsDir   string
+	runnerDir string
+	cleanup   func()
+}
+
+func (b *bundle) Close() {
+	if b.cleanup != nil {
+		b.cleanup()
+	}
+}
+
+// remoteBundle downloads and verifies the release archives listed in entry,
+// then extracts them into a temp staging directory.
+func remoteBundle(baseURL string, entry CompatEntry) (*bundle, error) {
+	jarsArchive, runnerArchive, err := downloadVerified(baseURL, entry)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(jarsArchive)
+	defer os.Remove(runnerArchive)
+
+	staging, err := os.MkdirTemp("", "maestro-setup-*")
+	if err != nil {
+		return nil, err
+	}
+	b := &bundle{
+		jarsDir:   filepath.Join(staging, "jars"),
+		runnerDir: filepath.Join(staging, runnerProject),
+		cleanup:   func() { os.RemoveAll(staging) },
+	}
+
+	if err := unzip(jarsArchive, b.jarsDir); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to extract JARs: %w", err)
+	}
+	if err := unzip(runnerArchive, b.runnerDir); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to extract runner: %w", err)
+	}
+	return b, nil
+}
+
+// localBundle uses a directory or zip laid out like this repo's assets:
+//
+//	jars/<version>/*.jar
+//	maestro-ios-xctest-runner/
+//
+// An enclosing assets/ folder is also accepted.
+func localBundle(from, version string) (*bundle, error) {
+	info, err := os.Stat(from)
+	if err != nil {
+		return nil, err
+	}
+
+	root := from
+	var cleanup func()
+	if !info.IsDir() {
+		if !strings.HasSuffix(strings.ToLower(from), ".zip") {
+			return nil, fmt.Errorf("%s is not a directory or zip archive", from)
+		}
+		staging, err := os.MkdirTemp("", "maestro-setup-*")
+		if err != nil {
+			return nil, err
+		}
+		cleanup = func() { os.RemoveAll(staging) }
+		if err := unzip(from, staging); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to extract %s: %w", from, err)
+		}
+		root = staging
+	}
+
+	b, err := findBundle(root, version)
+	if err != nil {
+		if cleanup != nil {
+			cleanup()
+		}
+		return nil, err
+	}
+	b.cleanup = cleanup
+	return b, nil
+}
+
+func findBundle(root, version string) (*bundle, error) {
+	for _, base := range []string{root, filepath.Join(root, "assets")} {
+		jarsDir := filepath.Join(base, "jars", version)
+		if !isDir(jarsDir) {
+			continue
+		}
+		runnerDir := filepath.Join(base, runnerProject)
+		if !isDir(runnerDir) {
+			return nil, fmt.Errorf("%s not found in %s", runnerProject, base)
+		}
+		return &bundle{jarsDir: jarsDir, runnerDir: runnerDir}, nil
+	}
+	return nil, fmt.Errorf("no JARs for Maestro %s in %s (expected jars/%s)", version, root, version)
+}
+
+var cliJarPattern = regexp.MustCompile(`^maestro-cli-(.+)\.jar$`)
+
+// validateJarSet makes sure the staged JARs belong to version: every JAR must
+// replace one that the stock lib already ships, and a version-stamped CLI JAR
+// must carry the detected version.
+func validateJarSet(version, jarsDir, libPath string) error {
+	staged, err := listJars(jarsDir)
+	if err != nil {
+		return err
+	}
+	stock, err := listJars(libPath)
+	if err != nil {
+		return err
+	}
+	return checkJarNames(version, staged, stock)
+}
+
+func checkJarNames(version string, staged, stock []string) error {
+	if len(staged) == 0 {
+		return fmt.Errorf("no Maestro JARs in bundle")
+	}
+
+	inStock := make(map[string]bool, len(stock))
+	for _, name := range stock {
+		inStock[name] = true
+	}
+
+	for _, name := range staged {
+		if m := cliJarPattern.FindStringSubmatch(name); m != nil && m[1] != version {
+			return fmt.Errorf("%s is built for Maestro %s, but %s is installed", name, m[1], version)
+		}
+		if !inStock[name] {
+			return fmt.Errorf("%s is not part of the Maestro %s lib", name, version)
+		}
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func installJars(jarsDir, libPath string) error {
+	names, err := listJars(jarsDir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no Maestro JARs in %s", jarsDir)
+	}
+	for _, name := range names {
+		if err := copyFile(filepath.Join(jarsDir, name), filepath.Join(libPath, name)); err != nil {
+			return fmt.Errorf("failed to install %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFileMode(path, target, info.Mode())
+	})
+}
+
+func copyFileMode(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,127 @@
+package maestro
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeBundle(t *testing.T, root string) {
+	t.Helper()
+	jarsDir := filepath.Join(root, "jars", "2.1.0")
+	runnerDir := filepath.Join(root, runnerProject, "maestro-driver-ios.xcodeproj")
+	os.MkdirAll(jarsDir, 0755)
+	os.MkdirAll(runnerDir, 0755)
+	os.WriteFile(filepath.Join(jarsDir, "maestro-cli-2.1.0.jar"), []byte("cli"), 0644)
+	os.WriteFile(filepath.Join(runnerDir, "project.pbxproj"), []byte("project"), 0644)
+}
+
+func TestLocalBundle_Dir(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+	}{
+		{"flat", ""},
+		{"assets", "assets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeBundle(t, filepath.Join(root, tt.layout))
+
+			b, err := localBundle(root, "2.1.0")
+			if err != nil {
+				t.Fatalf("localBundle failed: %v", err)
+			}
+			defer b.Close()
+
+			if want := filepath.Join(root, tt.layout, "jars", "2.1.0"); b.jarsDir != want {
+				t.Errorf("jarsDir = %q, want %q", b.jarsDir, want)
+			}
+		})
+	}
+}
+
+func TestLocalBundle_UnknownVersion(t *testing.T) {
+	root := t.TempDir()
+	writeBundle(t, root)
+
+	if _, err := localBundle(root, "2.0.9"); err == nil {
+		t.Error("expected error for version without JARs")
+	}
+}
+
+func TestLocalBundle_Zip(t *testing.T) {
+	src := t.TempDir()
+	writeBundle(t, src)
+
+	archive := filepath.Join(t.TempDir(), "bundle.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(src, path)
+		w, _ := zw.Create(filepath.ToSlash(rel))
+		data, _ := os.ReadFile(path)
+		w.Write(data)
+		return nil
+	})
+	zw.Close()
+	f.Close()
+
+	b, err := localBundle(archive, "2.1.0")
+	if err != nil {
+		t.Fatalf("localBundle failed: %v", err)
+	}
+
+	libDir := t.TempDir()
+	if err := installJars(b.jarsDir, libDir); err != nil {
+		t.Fatalf("installJars failed: %v", err)
+	}
+	runnerDir := t.TempDir()
+	if err := copyDir(b.runnerDir, runnerDir); err != nil {
+		t.Fatalf("copyDir failed: %v", err)
+	}
+	b.Close()
+
+	if _, err := os.Stat(filepath.Join(libDir, "maestro-cli-2.1.0.jar")); err != nil {
+		t.Error("expected JAR to be installed")
+	}
+	if _, err := os.Stat(filepath.Join(runnerDir, "maestro-driver-ios.xcodeproj", "project.pbxproj")); err != nil {
+		t.Error("expected runner project to be copied")
+	}
+	if _, err := os.Stat(b.jarsDir); !os.IsNotExist(err) {
+		t.Error("expected staging directory to be removed")
+	}
+}
+
+func TestCheckJarNames(t *testing.T) {
+	stock := []string{"maestro-cli-2.0.9.jar", "maestro-ios.jar", "maestro-utils.jar"}
+
+	tests := []struct {
+		name    string
+		staged  []string
+		wantErr bool
+	}{
+		{"matching set", []string{"maestro-cli-2.0.9.jar", "maestro-ios.jar"}, false},
+		{"wrong cli version", []string{"maestro-cli-2.1.0.jar", "maestro-ios.jar"}, true},
+		{"unknown jar", []string{"maestro-cli-2.0.9.jar", "maestro-extra.jar"}, true},
+		{"empty", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJarNames("2.0.9", tt.staged, stock)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkJarNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package maestro
+
+import (
+	"context"
+	"sync"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+)
+
+// CLI runs the maestro and xcodebuild commands this package needs.
+type CLI interface {
+	// Version returns the output of `maestro --version`.
+	Version() (string, error)
+	// Help returns the output of `maestro --help`.
+	Help() (string, error)
+	// Path returns the maestro launcher script found in PATH.
+	Path() (string, error)
+	// XcodeVersion returns the output of `xcodebuild -version`.
+	XcodeVersion() (string, error)
+}
+
+// ExecCLI implements CLI on top of an executor.
+type ExecCLI struct {
+	Exec execx.Executor
+}
+
+func (c ExecCLI) Version() (string, error) {
+	return c.output("maestro", "--version")
+}
+
+func (c ExecCLI) Help() (string, error) {
+	return c.output("maestro", "--help")
+}
+
+func (c ExecCLI) Path() (string, error) {
+	return c.Exec.LookPath("maestro")
+}
+
+func (c ExecCLI) XcodeVersion() (string, error) {
+	return c.output("xcodebuild", "-version")
+}
+
+func (c ExecCLI) output(name string, args ...string) (string, error) {
+	out, err := c.Exec.Output(context.Background(), name, args...)
+	return string(out), err
+}
+
+var (
+	cliMu sync.RWMutex
+	cli   CLI = ExecCLI{Exec: execx.OS{}}
+)
+
+// SetCLI replaces the CLI used by this package, e.g. with an ExecCLI over an
+// execx.Fake, and returns a func that restores the previous one.
+func SetCLI(c CLI) (restore func()) {
+	cliMu.Lock()
+	defer cliMu.Unlock()
+	prev := cli
+	cli = c
+	return func() {
+		cliMu.Lock()
+		defer cliMu.Unlock()
+		cli = prev
+	}
+}
+
+func currentCLI() CLI {
+	cliMu.RLock()
+	defer cliMu.RUnlock()
+	return cli
+}
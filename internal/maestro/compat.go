@@ -0,0 +1,230 @@
+package maestro
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+)
+
+const (
+	compatFile          = "compat.json"
+	compatSchemaVersion = 1
+	compatBuiltin       = "built-in"
+)
+
+// Compat is the compatibility matrix mapping Maestro versions to the release
+// artifacts built for them.
+type Compat struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	Versions      map[string]CompatEntry `json:"versions"`
+
+	// Source is where the matrix was loaded from: a URL, a file path or
+	// "built-in".
+	Source string `json:"-"`
+}
+
+type CompatEntry struct {
+	Jars   Artifact `json:"jars"`
+	Runner Artifact `json:"runner"`
+	// MinXcode is the oldest Xcode setup accepts for this version.
+	MinXcode string `json:"minXcode,omitempty"`
+}
+
+type Artifact struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// builtinCompat is the fallback matrix used when no manifest can be loaded.
+func builtinCompat() *Compat {
+	c := &Compat{
+		SchemaVersion: compatSchemaVersion,
+		Versions:      make(map[string]CompatEntry, len(supportedVersions)),
+		Source:        compatBuiltin,
+	}
+	for _, v := range supportedVersions {
+		c.Versions[v] = CompatEntry{
+			Jars:   Artifact{Name: fmt.Sprintf(jarsZip, v)},
+			Runner: Artifact{Name: runnerZip},
+		}
+	}
+	return c
+}
+
+// LoadCompat resolves the compatibility matrix. A local file is used when
+// given; otherwise the manifest is fetched from baseURL (skipped when empty).
+// Any failure falls back to the built-in matrix, with the reason returned as
+// a warning.
+func LoadCompat(file, baseURL string) (*Compat, error) {
+	var (
+		c   *Compat
+		err error
+	)
+	switch {
+	case file != "":
+		c, err = readCompatFile(file)
+	case baseURL != "":
+		c, err = fetchCompat(baseURL)
+	default:
+		return builtinCompat(), nil
+	}
+	if err != nil {
+		return builtinCompat(), err
+	}
+	return c, nil
+}
+
+// DefaultCompat loads the matrix published with the latest release.
+func DefaultCompat() (*Compat, error) {
+	return LoadCompat("", releaseURL)
+}
+
+func readCompatFile(path string) (*Compat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCompat(data, path)
+}
+
+// fetchCompat downloads the release's compat.json and checks it against the
+// release checksum manifest, so a tampered matrix cannot point setup at other
+// artifacts or pins.
+func fetchCompat(baseURL string) (*Compat, error) {
+	sums, err := fetchChecksums(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	url := baseURL + "/" + compatFile
+	data, err := fetch(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyData(sums, compatFile, data); err != nil {
+		return nil, err
+	}
+	return parseCompat(data, url)
+}
+
+func parseCompat(data []byte, source string) (*Compat, error) {
+	var c Compat
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	if c.SchemaVersion != compatSchemaVersion {
+		return nil, fmt.Errorf("%s: unsupported schema version %d", source, c.SchemaVersion)
+	}
+	if len(c.Versions) == 0 {
+		return nil, fmt.Errorf("%s: no versions", source)
+	}
+	for v, e := range c.Versions {
+		if e.Jars.Name == "" || e.Runner.Name == "" {
+			return nil, fmt.Errorf("%s: version %s is missing artifact names", source, v)
+		}
+	}
+	c.Source = source
+	return &c, nil
+}
+
+// Lookup returns the entry for version.
+func (c *Compat) Lookup(version string) (CompatEntry, bool) {
+	e, ok := c.Versions[version]
+	return e, ok
+}
+
+// SortedVersions returns the supported Maestro versions, newest first.
+func (c *Compat) SortedVersions() []string {
+	versions := make([]string, 0, len(c.Versions))
+	for v := range c.Versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) > 0
+	})
+	return versions
+}
+
+func (c *Compat) unsupportedError(version string) error {
+	return &UnsupportedVersionError{Version: version, Supported: c.SortedVersions()}
+}
+
+// CompareVersions compares dotted numeric versions, returning -1, 0 or 1.
+// Missing components count as zero, so "15" == "15.0".
+func CompareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// XcodeVersion returns the installed Xcode version, e.g. "16.2".
+func XcodeVersion() (string, error) {
+	out, err := currentCLI().XcodeVersion()
+	if err != nil {
+		return "", err
+	}
+	return parseXcodeVersion(out), nil
+}
+
+func parseXcodeVersion(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "Xcode" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+func RunCompat(file string) error {
+	c, err := LoadCompat(file, releaseURL)
+	if err != nil {
+		fmt.Printf("⚠️  Could not load compatibility manifest: %s\n", err)
+	}
+
+	_, installed, _ := Installed()
+
+	fmt.Printf("Compatibility matrix (%s)\n\n", c.Source)
+	fmt.Printf("  %-10s %-28s %-24s %s\n", "MAESTRO", "JARS", "RUNNER", "XCODE")
+	for _, v := range c.SortedVersions() {
+		e := c.Versions[v]
+		marker := " "
+		if v == installed {
+			marker = "*"
+		}
+		fmt.Printf("%s %-10s %-28s %-24s %s\n", marker, v, e.Jars.Name, e.Runner.Name, utils.OrDash(e.MinXcode))
+	}
+	if installed != "" {
+		fmt.Printf("\n* installed (%s)\n", installed)
+	}
+	return nil
+}
+
+// bundleCompat returns the path of a compat.json shipped inside a local
+// bundle, if any.
+func bundleCompat(from string) string {
+	for _, path := range []string{filepath.Join(from, compatFile), filepath.Join(from, "assets", compatFile)} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
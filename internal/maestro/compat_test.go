@@ -0,0 +1,166 @@
+package maestro
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCompat = `{
+  "schemaVersion": 1,
+  "versions": {
+    "2.2.0": {
+      "jars": {"name": "maestro-jars-2.2.0.zip", "sha256": "abc"},
+      "runner": {"name": "maestro-ios-runner.zip"},
+      "minXcode": "16.0"
+    },
+    "2.1.0": {
+      "jars": {"name": "maestro-jars-2.1.0.zip"},
+      "runner": {"name": "maestro-ios-runner.zip"}
+    }
+  }
+}`
+
+func TestParseCompat(t *testing.T) {
+	c, err := parseCompat([]byte(testCompat), "test")
+	if err != nil {
+		t.Fatalf("parseCompat failed: %v", err)
+	}
+	e, ok := c.Lookup("2.2.0")
+	if !ok {
+		t.Fatal("expected 2.2.0 entry")
+	}
+	if e.Jars.Name != "maestro-jars-2.2.0.zip" || e.Jars.SHA256 != "abc" || e.MinXcode != "16.0" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if _, ok := c.Lookup("2.0.9"); ok {
+		t.Error("did not expect 2.0.9 entry")
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"schemaVersion": 2, "versions": {"2.1.0": {"jars": {"name": "a"}, "runner": {"name": "b"}}}}`,
+		`{"schemaVersion": 1, "versions": {}}`,
+		`{"schemaVersion": 1, "versions": {"2.1.0": {"jars": {"name": "a"}}}}`,
+	}
+	for _, data := range invalid {
+		if _, err := parseCompat([]byte(data), "test"); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestLoadCompat(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), compatFile)
+		os.WriteFile(path, []byte(testCompat), 0644)
+
+		c, err := LoadCompat(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Source != path {
+			t.Errorf("Source = %q, want %q", c.Source, path)
+		}
+	})
+
+	// serve publishes testCompat with a checksum manifest listing sum for it
+	serve := func(sum string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/" + checksumsFile:
+				fmt.Fprintf(w, "%s  %s\n", sum, compatFile)
+			case "/" + compatFile:
+				w.Write([]byte(testCompat))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+
+	t.Run("remote", func(t *testing.T) {
+		sum := sha256.Sum256([]byte(testCompat))
+		srv := serve(hex.EncodeToString(sum[:]))
+		defer srv.Close()
+
+		c, err := LoadCompat("", srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.Lookup("2.2.0"); !ok {
+			t.Error("expected 2.2.0 entry from remote manifest")
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		srv := serve(strings.Repeat("0", 64))
+		defer srv.Close()
+
+		c, err := LoadCompat("", srv.URL)
+		var ce *ChecksumError
+		if !errors.As(err, &ce) {
+			t.Errorf("err = %v, want a checksum mismatch", err)
+		}
+		if c.Source != compatBuiltin {
+			t.Errorf("Source = %q, want %q", c.Source, compatBuiltin)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		c, err := LoadCompat("", srv.URL)
+		if err == nil {
+			t.Error("expected error to be reported")
+		}
+		if c.Source != compatBuiltin {
+			t.Errorf("Source = %q, want %q", c.Source, compatBuiltin)
+		}
+		if _, ok := c.Lookup("2.0.10"); !ok {
+			t.Error("expected built-in 2.0.10 entry")
+		}
+	})
+}
+
+func TestSortedVersions(t *testing.T) {
+	got := builtinCompat().SortedVersions()
+	want := []string{"2.1.0", "2.0.10", "2.0.9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedVersions() = %v, want %v", got, want)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.0.10", "2.0.9", 1},
+		{"15.0", "15", 0},
+		{"15.4", "16.0", -1},
+		{"16.2", "16.2.1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseXcodeVersion(t *testing.T) {
+	if got := parseXcodeVersion("Xcode 16.2\nBuild version 16C5032a\n"); got != "16.2" {
+		t.Errorf("got %q, want %q", got, "16.2")
+	}
+	if got := parseXcodeVersion("xcode-select: error"); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+}
@@ -0,0 +1,55 @@
+package maestro
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNotInstalled    = errors.New("Maestro not found")
+	ErrNotPatched      = errors.New("Maestro not patched")
+	ErrRunnerNotFound  = errors.New("iOS runner not found")
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrAlreadyPatched  = errors.New("Maestro JARs are already patched")
+	ErrUnsupported     = errors.New("unsupported Maestro version")
+	ErrChecksumInvalid = errors.New("checksum mismatch")
+	ErrXcodeTooOld     = errors.New("Xcode is too old")
+)
+
+// UnsupportedVersionError is returned when there are no patched JARs for the
+// installed Maestro. It matches ErrUnsupported.
+type UnsupportedVersionError struct {
+	Version   string
+	Supported []string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Unsupported Maestro version: %s\n\nSupported versions: %s\n\nPlease upgrade or downgrade Maestro to a supported version.",
+		e.Version, strings.Join(e.Supported, ", "))
+}
+
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// ChecksumError is returned when a download does not match its published
+// checksum. It matches ErrChecksumInvalid.
+type ChecksumError struct {
+	Name string
+	Got  string
+	Want string
+	// Source names where Want came from when it is not checksums.txt.
+	Source string
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("checksum mismatch for %s: %s expects %s", e.Name, e.Source, e.Want)
+	}
+	return fmt.Sprintf("checksum mismatch for %s: got %s, want %s", e.Name, e.Got, e.Want)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumInvalid
+}
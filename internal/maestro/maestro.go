@@ -2,6 +2,7 @@ package maestro
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,54 +11,93 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 const (
 	releaseURL = "https://github.com/devicelab-dev/maestro-ios-device/releases/latest/download"
-	jarsZip    = "maestro-jars.zip"
+	jarsZip    = "maestro-jars-%s.zip"
 	runnerZip  = "maestro-ios-runner.zip"
 	runnerDir  = ".maestro/maestro-ios-xctest-runner"
+	backupDir  = ".maestro/backup"
 )
 
+// supportedVersions backs the built-in compatibility matrix, used when the
+// release compat.json cannot be loaded.
 var supportedVersions = []string{"2.0.9", "2.0.10", "2.1.0"}
 
-func isSupportedVersion(version string) bool {
-	for _, v := range supportedVersions {
-		if version == v {
-			return true
-		}
+func runnerBasePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
-	return false
+	return filepath.Join(home, runnerDir), nil
 }
 
-func runnerBasePath() (string, error) {
+func backupBasePath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, runnerDir), nil
+	return filepath.Join(home, backupDir), nil
 }
 
-func RunSetup() error {
+type SetupOptions struct {
+	// From installs from a local directory or zip instead of downloading
+	// the latest release.
+	From string
+	// Compat is a local compatibility manifest to use instead of the one
+	// published with the release.
+	Compat string
+}
+
+func resolveCompat(opts SetupOptions) (*Compat, error) {
+	switch {
+	case opts.Compat != "":
+		return LoadCompat(opts.Compat, "")
+	case opts.From != "":
+		// Offline installs never reach out to GitHub
+		return LoadCompat(bundleCompat(opts.From), "")
+	default:
+		return LoadCompat("", releaseURL)
+	}
+}
+
+func RunSetup(opts SetupOptions) error {
 	fmt.Println("🔧 Maestro iOS Device Setup")
 	fmt.Println()
 
 	// Check Maestro installed
-	installed, version, err := checkInstalled()
+	installed, version, err := Installed()
 	if err != nil {
 		return err
 	}
 	if !installed {
-		return fmt.Errorf("Maestro not found. Install from: https://maestro.mobile.dev/")
+		return fmt.Errorf("%w. Install from: https://maestro.mobile.dev/", ErrNotInstalled)
 	}
 
 	fmt.Printf("Detected Maestro: %s\n", version)
 
-	if !isSupportedVersion(version) {
-		return fmt.Errorf("Unsupported Maestro version: %s\n\nSupported versions: 2.0.9, 2.0.10, 2.1.0\n\nPlease upgrade or downgrade Maestro to a supported version.", version)
+	compat, err := resolveCompat(opts)
+	if err != nil {
+		if opts.Compat != "" {
+			return fmt.Errorf("failed to load %s: %w", opts.Compat, err)
+		}
+		fmt.Printf("⚠️  Could not load compatibility manifest, using built-in list: %s\n", err)
+	}
+
+	entry, ok := compat.Lookup(version)
+	if !ok {
+		return compat.unsupportedError(version)
 	}
 
-	libPath, err := getLibPath()
+	if entry.MinXcode != "" {
+		if xcode, err := XcodeVersion(); err == nil && xcode != "" && CompareVersions(xcode, entry.MinXcode) < 0 {
+			return fmt.Errorf("%w: Maestro %s needs Xcode %s or newer, found %s. Update Xcode from the App Store", ErrXcodeTooOld, version, entry.MinXcode, xcode)
+		}
+	}
+
+	libPath, err := LibPath()
 	if err != nil {
 		return fmt.Errorf("failed to find Maestro lib: %w", err)
 	}
@@ -68,27 +108,54 @@ func RunSetup() error {
 	}
 
 	fmt.Println()
+	var b *bundle
+	if opts.From != "" {
+		fmt.Printf("📂 Using local bundle: %s\n", opts.From)
+		b, err = localBundle(opts.From, version)
+	} else {
+		fmt.Println("📥 Downloading JARs and iOS runner...")
+		b, err = remoteBundle(releaseURL, entry)
+		if err == nil {
+			fmt.Println("✅ Checksums verified")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if err := validateJarSet(version, b.jarsDir, libPath); err != nil {
+		return err
+	}
+
 	fmt.Println("📦 Backing up existing JARs...")
-	if err := backupJars(libPath); err != nil {
+	if err := backupJars(libPath, version); err != nil {
 		return fmt.Errorf("failed to backup JARs: %w", err)
 	}
 	fmt.Println("✅ Backup complete")
 
-	fmt.Println("📥 Downloading JARs...")
-	if err := downloadAndExtract(releaseURL+"/"+jarsZip, libPath); err != nil {
-		return fmt.Errorf("failed to download JARs: %w", err)
+	if err := installJars(b.jarsDir, libPath); err != nil {
+		return fmt.Errorf("failed to install JARs: %w", err)
 	}
 	fmt.Println("✅ JARs installed")
 
-	fmt.Println("📥 Downloading iOS runner...")
 	if err := os.MkdirAll(runnerPath, 0755); err != nil {
 		return err
 	}
-	if err := downloadAndExtract(releaseURL+"/"+runnerZip, runnerPath); err != nil {
-		return fmt.Errorf("failed to download runner: %w", err)
+	if err := copyDir(b.runnerDir, runnerPath); err != nil {
+		return fmt.Errorf("failed to install runner: %w", err)
 	}
 	fmt.Println("✅ iOS runner installed")
 
+	patched, err := IsPatched()
+	if err != nil {
+		return fmt.Errorf("could not verify install: %w", err)
+	}
+	if !patched {
+		return fmt.Errorf("%w: Maestro does not report --driver-host-port after install. Check %s", ErrNotPatched, libPath)
+	}
+	fmt.Println("✅ Maestro patched")
+
 	fmt.Println()
 	fmt.Println("✅ Setup complete!")
 	fmt.Println()
@@ -99,11 +166,11 @@ func RunSetup() error {
 }
 
 func IsPatched() (bool, error) {
-	out, err := exec.Command("maestro", "--help").Output()
+	out, err := currentCLI().Help()
 	if err != nil {
 		return false, err
 	}
-	return strings.Contains(string(out), "driver-host-port"), nil
+	return strings.Contains(out, "driver-host-port"), nil
 }
 
 func GetRunnerPath() (string, error) {
@@ -114,21 +181,22 @@ func GetRunnerPath() (string, error) {
 
 	path := filepath.Join(basePath, "maestro-driver-ios.xcodeproj")
 	if _, err := os.Stat(path); err != nil {
-		return "", fmt.Errorf("iOS runner not found. Run: maestro-ios-device setup")
+		return "", fmt.Errorf("%w. Run: maestro-ios-device setup", ErrRunnerNotFound)
 	}
 
 	return basePath, nil
 }
 
-func checkInstalled() (bool, string, error) {
-	out, err := exec.Command("maestro", "--version").Output()
+// Installed reports whether the maestro CLI is on PATH and its version.
+func Installed() (bool, string, error) {
+	out, err := currentCLI().Version()
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "executable file not found") {
+		if errors.Is(err, exec.ErrNotFound) {
 			return false, "", nil
 		}
 		return false, "", err
 	}
-	return true, parseVersion(string(out)), nil
+	return true, parseVersion(out), nil
 }
 
 func parseVersion(out string) string {
@@ -150,13 +218,13 @@ func parseVersion(out string) string {
 	return out
 }
 
-func getLibPath() (string, error) {
-	scriptPath, err := exec.Command("which", "maestro").Output()
+// LibPath returns the directory holding the Maestro JARs.
+func LibPath() (string, error) {
+	script, err := currentCLI().Path()
 	if err != nil {
-		return "", fmt.Errorf("maestro not in PATH")
+		return "", fmt.Errorf("%w in PATH", ErrNotInstalled)
 	}
 
-	script := strings.TrimSpace(string(scriptPath))
 	if resolved, err := filepath.EvalSymlinks(script); err == nil {
 		script = resolved
 	}
@@ -204,77 +272,87 @@ func findLibInScript(content, scriptDir string) string {
 	return ""
 }
 
-func backupJars(libPath string) error {
-	home, err := os.UserHomeDir()
+func copyFile(src, dst string) error {
+	return copyFileMode(src, dst, 0644)
+}
+
+// downloadVerified fetches the archives listed in entry into temp files and
+// checks them against the release checksum manifest, so nothing in the
+// Maestro lib is touched unless every archive is intact.
+func downloadVerified(baseURL string, entry CompatEntry) (jarsArchive, runnerArchive string, err error) {
+	sums, err := fetchChecksums(baseURL)
 	if err != nil {
-		return err
-	}
-	backupDir := filepath.Join(home, ".maestro", "backup")
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return err
+		return "", "", err
 	}
 
-	entries, err := os.ReadDir(libPath)
+	jarsArchive, err = downloadChecked(baseURL, entry.Jars, sums)
 	if err != nil {
-		return err
+		return "", "", fmt.Errorf("failed to download JARs: %w", err)
 	}
 
-	for _, entry := range entries {
-		name := entry.Name()
-		if !strings.HasPrefix(name, "maestro") || !strings.HasSuffix(name, ".jar") {
-			continue
-		}
-		src := filepath.Join(libPath, name)
-		dst := filepath.Join(backupDir, name)
-		if err := copyFile(src, dst); err != nil {
-			return fmt.Errorf("failed to backup %s: %w", name, err)
-		}
+	runnerArchive, err = downloadChecked(baseURL, entry.Runner, sums)
+	if err != nil {
+		os.Remove(jarsArchive)
+		return "", "", fmt.Errorf("failed to download runner: %w", err)
 	}
-	return nil
+
+	return jarsArchive, runnerArchive, nil
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+func downloadChecked(baseURL string, a Artifact, sums map[string]string) (string, error) {
+	path, err := download(baseURL + "/" + a.Name)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer in.Close()
+	if err := verifyArtifact(sums, a, path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
 
-	out, err := os.Create(dst)
+// fetchClient bounds downloads of small release files, so a slow network
+// does not hang doctor or compat.
+var fetchClient = &http.Client{Timeout: 10 * time.Second}
+
+func fetch(url string) ([]byte, error) {
+	resp, err := fetchClient.Get(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer out.Close()
+	defer resp.Body.Close()
 
-	_, err = io.Copy(out, in)
-	return err
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
 }
 
-func downloadAndExtract(url, dest string) error {
+// download saves url to a temp file and returns its path. The caller removes it.
+func download(url string) (string, error) {
 	resp, err := http.Get(url)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed: %s", resp.Status)
+		return "", fmt.Errorf("download failed: %s", resp.Status)
 	}
 
 	tmp, err := os.CreateTemp("", "maestro-*.zip")
 	if err != nil {
-		return err
+		return "", err
 	}
-	tmpName := tmp.Name()
-	defer os.Remove(tmpName)
 
 	if _, err := io.Copy(tmp, resp.Body); err != nil {
 		tmp.Close()
-		return err
+		os.Remove(tmp.Name())
+		return "", err
 	}
 	tmp.Close()
 
-	return unzip(tmpName, dest)
+	return tmp.Name(), nil
 }
 
 func unzip(src, dest string) error {
@@ -324,4 +402,3 @@ func extractFile(f *zip.File, target string) error {
 	_, err = io.Copy(out, rc)
 	return err
 }
-
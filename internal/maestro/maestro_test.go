@@ -4,7 +4,9 @@ import (
 	"archive/zip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseVersion(t *testing.T) {
@@ -174,3 +176,149 @@ func TestFindLibInScript(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreJars(t *testing.T) {
+	backupDir := t.TempDir()
+	libDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(backupDir, "maestro-cli-2.1.0.jar"), []byte("original"), 0644)
+	os.WriteFile(filepath.Join(libDir, "maestro-cli-2.1.0.jar"), []byte("patched"), 0644)
+	os.WriteFile(filepath.Join(libDir, "maestro-extra.jar"), []byte("patched"), 0644)
+	os.WriteFile(filepath.Join(libDir, "kotlin-stdlib.jar"), []byte("other"), 0644)
+
+	if err := restoreJars(backupDir, libDir, []string{"maestro-cli-2.1.0.jar"}); err != nil {
+		t.Fatalf("restoreJars failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(libDir, "maestro-cli-2.1.0.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "original" {
+		t.Errorf("got %q, want %q", content, "original")
+	}
+	if _, err := os.Stat(filepath.Join(libDir, "maestro-extra.jar")); !os.IsNotExist(err) {
+		t.Error("expected patched JAR without backup to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(libDir, "kotlin-stdlib.jar")); err != nil {
+		t.Error("expected non-Maestro JAR to be kept")
+	}
+}
+
+func TestCreateBackup(t *testing.T) {
+	root := t.TempDir()
+	libDir := t.TempDir()
+	os.WriteFile(filepath.Join(libDir, "maestro-cli-2.1.0.jar"), []byte("original"), 0644)
+	os.WriteFile(filepath.Join(libDir, "kotlin-stdlib.jar"), []byte("other"), 0644)
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	b, err := createBackup(root, libDir, "2.1.0", now)
+	if err != nil {
+		t.Fatalf("createBackup failed: %v", err)
+	}
+	if b.ID != "20250102-030405" {
+		t.Errorf("got ID %q, want %q", b.ID, "20250102-030405")
+	}
+
+	backups, err := listBackups(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	got := backups[0]
+	if got.MaestroVersion != "2.1.0" || len(got.Files) != 1 || got.Files[0].Name != "maestro-cli-2.1.0.jar" {
+		t.Errorf("unexpected manifest: %+v", got)
+	}
+	if got.Files[0].Size != int64(len("original")) {
+		t.Errorf("got size %d, want %d", got.Files[0].Size, len("original"))
+	}
+	if err := got.verify(); err != nil {
+		t.Errorf("verify failed: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(got.dir, "maestro-cli-2.1.0.jar"), []byte("tampered"), 0644)
+	if err := got.verify(); err == nil {
+		t.Error("expected verify to fail for modified file")
+	}
+}
+
+func TestCreateBackup_SameSecond(t *testing.T) {
+	root := t.TempDir()
+	libDir := t.TempDir()
+	os.WriteFile(filepath.Join(libDir, "maestro-cli-2.1.0.jar"), []byte("original"), 0644)
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	var ids []string
+	for i := range 3 {
+		b, err := createBackup(root, libDir, "2.1.0", now.Add(time.Duration(i)*time.Millisecond))
+		if err != nil {
+			t.Fatalf("createBackup #%d failed: %v", i+1, err)
+		}
+		ids = append(ids, b.ID)
+	}
+	want := []string{"20250102-030405", "20250102-030405-2", "20250102-030405-3"}
+	if strings.Join(ids, " ") != strings.Join(want, " ") {
+		t.Errorf("IDs = %v, want %v", ids, want)
+	}
+
+	if b, err := latestBackup(root, "2.1.0"); err != nil || b.ID != want[2] {
+		t.Errorf("latestBackup() = %v, %v; want %s", b, err, want[2])
+	}
+}
+
+func TestCreateBackup_RefusesPatched(t *testing.T) {
+	root := t.TempDir()
+	libDir := t.TempDir()
+
+	patched, err := os.ReadFile(filepath.Join("..", "..", "assets", "jars", "2.1.0", "maestro-ios.jar"))
+	if err != nil {
+		t.Skip("patched JAR assets not available")
+	}
+	os.WriteFile(filepath.Join(libDir, "maestro-ios.jar"), patched, 0644)
+
+	if _, err := createBackup(root, libDir, "2.1.0", time.Now()); err == nil {
+		t.Error("expected error when backing up patched JARs")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("expected no backup folder, got %d entries", len(entries))
+	}
+}
+
+func TestLatestBackup(t *testing.T) {
+	root := t.TempDir()
+	libDir := t.TempDir()
+	os.WriteFile(filepath.Join(libDir, "maestro-cli.jar"), []byte("v1"), 0644)
+
+	// Legacy flat backup from older releases
+	os.WriteFile(filepath.Join(root, "maestro-cli.jar"), []byte("legacy"), 0644)
+
+	if _, err := createBackup(root, libDir, "2.0.9", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createBackup(root, libDir, "2.1.0", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", "20250201-000000"},
+		{"2.1.0", "20250201-000000"},
+		{"2.0.9", "20250101-000000"},
+		{"2.0.10", legacyBackupID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			b, err := latestBackup(root, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.ID != tt.want {
+				t.Errorf("latestBackup(%q) = %q, want %q", tt.version, b.ID, tt.want)
+			}
+		})
+	}
+}
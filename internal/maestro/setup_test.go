@@ -0,0 +1,161 @@
+package maestro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+)
+
+// fakeMaestro installs a stock Maestro 2.1.0 under a temp dir and scripts
+// the maestro CLI so --help reports the patch once the CLI JAR is replaced.
+func fakeMaestro(t *testing.T) (libPath string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	root := t.TempDir()
+	libPath = filepath.Join(root, "lib")
+	os.MkdirAll(filepath.Join(root, "bin"), 0755)
+	os.MkdirAll(libPath, 0755)
+	os.WriteFile(filepath.Join(root, "bin", "maestro"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar"), []byte("stock"), 0644)
+
+	fake := execx.NewFake()
+	fake.SetPath("maestro", filepath.Join(root, "bin", "maestro"))
+	fake.Handle("maestro", func(_ context.Context, args []string, out io.Writer) error {
+		switch args[0] {
+		case "--version":
+			fmt.Fprintln(out, "2.1.0")
+		case "--help":
+			fmt.Fprintln(out, "Usage: maestro [options]")
+			if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) == "cli" {
+				fmt.Fprintln(out, "  --driver-host-port=<port>")
+			}
+		}
+		return nil
+	})
+	fake.Handle("xcodebuild", execx.Print("Xcode 16.2\nBuild version 16C5032a\n"))
+	t.Cleanup(SetCLI(ExecCLI{Exec: fake}))
+	return libPath
+}
+
+func TestRunSetup_Offline(t *testing.T) {
+	libPath := fakeMaestro(t)
+	bundle := t.TempDir()
+	writeBundle(t, bundle)
+
+	if patched, _ := IsPatched(); patched {
+		t.Fatal("stock Maestro reported as patched")
+	}
+	if err := RunSetup(SetupOptions{From: bundle}); err != nil {
+		t.Fatalf("RunSetup() = %v", err)
+	}
+
+	if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) != "cli" {
+		t.Errorf("CLI JAR = %q, want the patched one", jar)
+	}
+	if _, err := GetRunnerPath(); err != nil {
+		t.Errorf("runner not installed: %v", err)
+	}
+	backups, err := ListBackups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("ListBackups() = %v, %v; want one backup", backups, err)
+	}
+
+	if err := RunUninstall(false); err != nil {
+		t.Fatalf("RunUninstall() = %v", err)
+	}
+	if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) != "stock" {
+		t.Errorf("CLI JAR = %q after uninstall, want the stock one", jar)
+	}
+}
+
+func TestRunSetup_NotInstalled(t *testing.T) {
+	t.Cleanup(SetCLI(ExecCLI{Exec: execx.NewFake()}))
+
+	if err := RunSetup(SetupOptions{}); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("RunSetup() = %v, want ErrNotInstalled", err)
+	}
+}
+
+func TestRunSetup_Unsupported(t *testing.T) {
+	fakeMaestro(t)
+	bundle := t.TempDir()
+	writeBundle(t, bundle)
+
+	fake := execx.NewFake()
+	fake.Handle("maestro", execx.Print("1.39.0\n"))
+	t.Cleanup(SetCLI(ExecCLI{Exec: fake}))
+
+	var unsupported *UnsupportedVersionError
+	if err := RunSetup(SetupOptions{From: bundle}); !errors.As(err, &unsupported) || unsupported.Version != "1.39.0" {
+		t.Errorf("RunSetup() = %v, want UnsupportedVersionError for 1.39.0", err)
+	}
+}
+
+func TestRunSetup_XcodeTooOld(t *testing.T) {
+	libPath := fakeMaestro(t)
+	bundle := t.TempDir()
+	writeBundle(t, bundle)
+	os.WriteFile(filepath.Join(bundle, compatFile), []byte(`{"schemaVersion": 1, "versions": {
+  "2.1.0": {"jars": {"name": "maestro-jars-2.1.0.zip"}, "runner": {"name": "maestro-ios-runner.zip"}, "minXcode": "17.0"}
+}}`), 0644)
+
+	if err := RunSetup(SetupOptions{From: bundle}); !errors.Is(err, ErrXcodeTooOld) {
+		t.Fatalf("RunSetup() = %v, want ErrXcodeTooOld", err)
+	}
+	if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) != "stock" {
+		t.Errorf("CLI JAR = %q, want it untouched", jar)
+	}
+}
+
+func TestRunUninstall_MatchesInstalledVersion(t *testing.T) {
+	libPath := fakeMaestro(t)
+	root, _ := backupBasePath()
+
+	// A 2.1.0 backup, then a newer one taken before a downgrade to 2.0.9.
+	if _, err := createBackup(root, libPath, "2.1.0", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	oldLib := t.TempDir()
+	os.WriteFile(filepath.Join(oldLib, "maestro-cli-2.0.9.jar"), []byte("stock 2.0.9"), 0644)
+	if _, err := createBackup(root, oldLib, "2.0.9", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar"), []byte("cli"), 0644)
+	if err := RunUninstall(false); err != nil {
+		t.Fatalf("RunUninstall() = %v", err)
+	}
+	if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) != "stock" {
+		t.Errorf("CLI JAR = %q, want the 2.1.0 backup", jar)
+	}
+	if _, err := os.Stat(filepath.Join(libPath, "maestro-cli-2.0.9.jar")); !os.IsNotExist(err) {
+		t.Error("2.0.9 backup restored into a 2.1.0 install")
+	}
+}
+
+func TestRunUninstall_NoBackupForVersion(t *testing.T) {
+	libPath := fakeMaestro(t)
+	root, _ := backupBasePath()
+
+	oldLib := t.TempDir()
+	os.WriteFile(filepath.Join(oldLib, "maestro-cli-2.0.9.jar"), []byte("stock 2.0.9"), 0644)
+	if _, err := createBackup(root, oldLib, "2.0.9", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar"), []byte("cli"), 0644)
+	if err := RunUninstall(false); !errors.Is(err, ErrBackupNotFound) {
+		t.Fatalf("RunUninstall() = %v, want ErrBackupNotFound", err)
+	}
+	if jar, _ := os.ReadFile(filepath.Join(libPath, "maestro-cli-2.1.0.jar")); string(jar) != "cli" {
+		t.Errorf("CLI JAR = %q, want it untouched", jar)
+	}
+}
@@ -0,0 +1,106 @@
+package maestro
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func RunUninstall(removeRunner bool) error {
+	fmt.Println("🧹 Maestro iOS Device Uninstall")
+	fmt.Println()
+
+	root, err := backupBasePath()
+	if err != nil {
+		return err
+	}
+
+	// A backup from another Maestro version would leave a mix of both
+	// versions' JARs behind, so only restore one matching the install.
+	installed, version, err := Installed()
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return ErrNotInstalled
+	}
+	b, err := latestBackup(root, version)
+	if err != nil {
+		return fmt.Errorf("%w for Maestro %s. Run: maestro-ios-device backup list, then maestro-ios-device backup restore <id>", ErrBackupNotFound, version)
+	}
+
+	if err := restoreBackup(b); err != nil {
+		return err
+	}
+
+	if removeRunner {
+		runnerPath, err := runnerBasePath()
+		if err != nil {
+			return err
+		}
+		fmt.Println("🗑️  Removing iOS runner...")
+		if err := os.RemoveAll(runnerPath); err != nil {
+			return fmt.Errorf("failed to remove runner: %w", err)
+		}
+		fmt.Println("✅ iOS runner removed")
+	}
+
+	patched, err := IsPatched()
+	if err != nil {
+		return fmt.Errorf("could not verify restore: %w", err)
+	}
+	if patched {
+		return fmt.Errorf("Maestro still reports --driver-host-port after restoring backup %s", b.ID)
+	}
+
+	fmt.Println()
+	fmt.Println("✅ Uninstall complete! Maestro restored to its original state.")
+	return nil
+}
+
+// restoreJars copies every backed up JAR into libPath and removes JARs
+// that were added by the patch (present in lib but absent from the backup).
+func restoreJars(backupDir, libPath string, backups []string) error {
+	keep := make(map[string]bool, len(backups))
+	for _, name := range backups {
+		keep[name] = true
+		if err := copyFile(filepath.Join(backupDir, name), filepath.Join(libPath, name)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+
+	current, err := listJars(libPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range current {
+		if keep[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(libPath, name)); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		fmt.Printf("   removed %s\n", name)
+	}
+	return nil
+}
+
+func listJars(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if isMaestroJar(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func isMaestroJar(name string) bool {
+	return strings.HasPrefix(name, "maestro") && strings.HasSuffix(name, ".jar")
+}
@@ -0,0 +1,126 @@
+package maestro
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	checksumsFile = "checksums.txt"
+	signatureFile = checksumsFile + ".sig"
+)
+
+// SigningPublicKey is the base64-encoded ed25519 key that release checksum
+// manifests are signed with. Set via -ldflags; when empty, signatures are not
+// checked and only the SHA-256 checksums are verified.
+var SigningPublicKey = ""
+
+// fetchChecksums downloads the release checksum manifest from baseURL and,
+// when SigningPublicKey is set, verifies its signature before parsing it.
+func fetchChecksums(baseURL string) (map[string]string, error) {
+	manifest, err := fetch(baseURL + "/" + checksumsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", checksumsFile, err)
+	}
+
+	if SigningPublicKey != "" {
+		sig, err := fetch(baseURL + "/" + signatureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", signatureFile, err)
+		}
+		if err := verifySignature(manifest, sig, SigningPublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseChecksums(manifest)
+}
+
+// parseChecksums reads a manifest in `sha256sum` format ("<hex>  <name>").
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != 64 {
+			return nil, fmt.Errorf("malformed checksum line: %q", line)
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		sums[name] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("checksum manifest is empty")
+	}
+	return sums, nil
+}
+
+func verifySignature(data, sig []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid signing public key")
+	}
+	// Accept both raw and base64-encoded signatures
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+			return fmt.Errorf("invalid %s: %w", signatureFile, err)
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return fmt.Errorf("%s signature verification failed", checksumsFile)
+	}
+	return nil
+}
+
+// verifyChecksum checks the file at path against the manifest entry for name.
+func verifyChecksum(sums map[string]string, name, path string) error {
+	want, ok := sums[name]
+	if !ok {
+		return fmt.Errorf("no checksum for %s in %s", name, checksumsFile)
+	}
+	got, _, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &ChecksumError{Name: name, Got: got, Want: want}
+	}
+	return nil
+}
+
+// verifyData checks data against the manifest entry for name.
+func verifyData(sums map[string]string, name string, data []byte) error {
+	want, ok := sums[name]
+	if !ok {
+		return fmt.Errorf("no checksum for %s in %s", name, checksumsFile)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return &ChecksumError{Name: name, Got: got, Want: want}
+	}
+	return nil
+}
+
+// verifyArtifact checks path against the checksum manifest and, when the
+// compatibility matrix pins one, the artifact's own checksum.
+func verifyArtifact(sums map[string]string, a Artifact, path string) error {
+	if err := verifyChecksum(sums, a.Name, path); err != nil {
+		return err
+	}
+	if a.SHA256 != "" && !strings.EqualFold(sums[a.Name], a.SHA256) {
+		return &ChecksumError{Name: a.Name, Got: sums[a.Name], Want: a.SHA256, Source: "compatibility manifest"}
+	}
+	return nil
+}
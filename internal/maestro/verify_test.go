@@ -0,0 +1,138 @@
+package maestro
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	sum := hex.EncodeToString(make([]byte, 32))
+	data := []byte(fmt.Sprintf("# comment\n%s  maestro-jars.zip\n%s *maestro-ios-runner.zip\n\n", sum, sum))
+
+	sums, err := parseChecksums(data)
+	if err != nil {
+		t.Fatalf("parseChecksums failed: %v", err)
+	}
+	if sums["maestro-jars.zip"] != sum || sums["maestro-ios-runner.zip"] != sum {
+		t.Errorf("unexpected checksums: %v", sums)
+	}
+
+	if _, err := parseChecksums([]byte("not a checksum")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+	if _, err := parseChecksums(nil); err == nil {
+		t.Error("expected error for empty manifest")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(pub)
+	data := []byte("checksums")
+	sig := ed25519.Sign(priv, data)
+
+	if err := verifySignature(data, sig, key); err != nil {
+		t.Errorf("raw signature: %v", err)
+	}
+	if err := verifySignature(data, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), key); err != nil {
+		t.Errorf("base64 signature: %v", err)
+	}
+	if err := verifySignature([]byte("tampered"), sig, key); err == nil {
+		t.Error("expected error for tampered data")
+	}
+	if err := verifySignature(data, sig, "bad key"); err == nil {
+		t.Error("expected error for invalid key")
+	}
+}
+
+func TestDownloadVerified(t *testing.T) {
+	jars := []byte("jars archive")
+	jarsName := fmt.Sprintf(jarsZip, "2.1.0")
+	entry := builtinCompat().Versions["2.1.0"]
+	runner := []byte("runner archive")
+
+	serve := func(manifest string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/" + checksumsFile:
+				w.Write([]byte(manifest))
+			case "/" + jarsName:
+				w.Write(jars)
+			case "/" + runnerZip:
+				w.Write(runner)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+	sha := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		srv := serve(fmt.Sprintf("%s  %s\n%s  %s\n", sha(jars), jarsName, sha(runner), runnerZip))
+		defer srv.Close()
+
+		jarsPath, runnerPath, err := downloadVerified(srv.URL, entry)
+		if err != nil {
+			t.Fatalf("downloadVerified failed: %v", err)
+		}
+		defer os.Remove(jarsPath)
+		defer os.Remove(runnerPath)
+
+		if got, _ := os.ReadFile(runnerPath); string(got) != string(runner) {
+			t.Errorf("got %q, want %q", got, runner)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		srv := serve(fmt.Sprintf("%s  %s\n%s  %s\n", sha(jars), jarsName, sha([]byte("other")), runnerZip))
+		defer srv.Close()
+
+		if _, _, err := downloadVerified(srv.URL, entry); err == nil {
+			t.Error("expected checksum mismatch error")
+		}
+	})
+
+	t.Run("missing manifest", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		if _, _, err := downloadVerified(srv.URL, entry); err == nil {
+			t.Error("expected error when checksum manifest is missing")
+		}
+	})
+}
+
+func TestDownloadVerified_PinnedChecksum(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + checksumsFile:
+			sum := sha256.Sum256([]byte("archive"))
+			fmt.Fprintf(w, "%s  jars.zip\n%s  runner.zip\n", hex.EncodeToString(sum[:]), hex.EncodeToString(sum[:]))
+		default:
+			w.Write([]byte("archive"))
+		}
+	}))
+	defer srv.Close()
+
+	entry := CompatEntry{
+		Jars:   Artifact{Name: "jars.zip", SHA256: hex.EncodeToString(make([]byte, 32))},
+		Runner: Artifact{Name: "runner.zip"},
+	}
+	if _, _, err := downloadVerified(srv.URL, entry); err == nil {
+		t.Error("expected error when compat checksum does not match")
+	}
+}
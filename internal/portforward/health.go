@@ -0,0 +1,89 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrForwardFailed means the tunnel could not be set up.
+	ErrForwardFailed = errors.New("port forward failed")
+	// ErrForwarderDown means nothing accepts connections on the local port.
+	ErrForwarderDown = errors.New("port forward is down")
+	// ErrDriverDown means the tunnel is up but the XCTest driver behind it
+	// does not answer.
+	ErrDriverDown = errors.New("driver is not responding")
+)
+
+const (
+	statusPath   = "/status"
+	probeTimeout = 5 * time.Second
+	maxBody      = 512
+)
+
+// Health is the driver's answer to a status request.
+type Health struct {
+	Latency time.Duration
+	Status  int
+	Body    string
+}
+
+// Probe sends one status request to the driver through the local port.
+// Errors wrap ErrForwarderDown or ErrDriverDown.
+func Probe(ctx context.Context, port int) (*Health, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// A failed dial means our listener is gone; anything after that is the
+	// driver's side of the tunnel
+	var (
+		mu      sync.Mutex
+		dialErr error
+	)
+	dialer := &net.Dialer{}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			mu.Lock()
+			dialErr = err
+			mu.Unlock()
+			return conn, err
+		},
+		DisableKeepAlives: true,
+	}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d%s", port, statusPath), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		if dialErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrForwarderDown, dialErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDriverDown, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	h := &Health{
+		Latency: time.Since(start),
+		Status:  resp.StatusCode,
+		Body:    strings.TrimSpace(string(body)),
+	}
+	if resp.StatusCode != http.StatusOK {
+		return h, fmt.Errorf("%w: %s %s", ErrDriverDown, resp.Status, h.Body)
+	}
+	return h, nil
+}
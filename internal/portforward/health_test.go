@@ -0,0 +1,128 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serverPort(t *testing.T, s *httptest.Server) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestProbe(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	}))
+	defer s.Close()
+
+	h, err := Probe(context.Background(), serverPort(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Status != 200 || h.Body != `{"status":"ok"}` || h.Latency <= 0 {
+		t.Errorf("Probe() = %+v", h)
+	}
+}
+
+func TestProbe_DriverError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	h, err := Probe(context.Background(), serverPort(t, s))
+	if !errors.Is(err, ErrDriverDown) {
+		t.Fatalf("err = %v, want ErrDriverDown", err)
+	}
+	if h == nil || h.Status != 500 {
+		t.Errorf("Probe() = %+v, want the 500 response", h)
+	}
+}
+
+func TestProbe_DriverDown(t *testing.T) {
+	// The forwarder accepts, then drops the connection when the device
+	// side refuses, just like a tunnel with no driver behind it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	_, err = Probe(context.Background(), l.Addr().(*net.TCPAddr).Port)
+	if !errors.Is(err, ErrDriverDown) {
+		t.Errorf("err = %v, want ErrDriverDown", err)
+	}
+}
+
+func TestProbe_ForwarderDown(t *testing.T) {
+	_, err := Probe(context.Background(), freePort(t))
+	if !errors.Is(err, ErrForwarderDown) {
+		t.Errorf("err = %v, want ErrForwarderDown", err)
+	}
+}
+
+func TestVerify_Retries(t *testing.T) {
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer s.Close()
+
+	p := &PortForwarder{localPort: uint16(serverPort(t, s)), verifyTimeout: 5 * time.Second, verifyInterval: time.Millisecond}
+	h, err := p.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 || h.Status != 200 {
+		t.Errorf("Verify() = %+v after %d calls", h, calls.Load())
+	}
+}
+
+func TestVerify_GivesUp(t *testing.T) {
+	p := &PortForwarder{localPort: uint16(freePort(t)), verifyTimeout: 50 * time.Millisecond, verifyInterval: 10 * time.Millisecond}
+	_, err := p.Verify(context.Background())
+	if !errors.Is(err, ErrForwarderDown) {
+		t.Errorf("err = %v, want ErrForwarderDown", err)
+	}
+}
@@ -1,35 +1,72 @@
 package portforward
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	goios "github.com/danielpaulus/go-ios/ios"
 	"github.com/danielpaulus/go-ios/ios/forward"
+)
+
+// Forwarder opens a tunnel from localPort on this host to devicePort on the
+// device. Closing the result tears it down.
+type Forwarder func(entry goios.DeviceEntry, localPort, devicePort uint16) (io.Closer, error)
 
-	"github.com/anthropics/maestro-ios-device/internal/utils"
+var (
+	forwarderMu sync.RWMutex
+	forwarder   Forwarder = usbmuxForward
 )
 
+// SetForwarder replaces how tunnels are opened, e.g. with one that serves a
+// stand-in driver locally, and returns a func that restores the previous one.
+func SetForwarder(f Forwarder) (restore func()) {
+	forwarderMu.Lock()
+	defer forwarderMu.Unlock()
+	prev := forwarder
+	forwarder = f
+	return func() {
+		forwarderMu.Lock()
+		defer forwarderMu.Unlock()
+		forwarder = prev
+	}
+}
+
+func usbmuxForward(entry goios.DeviceEntry, localPort, devicePort uint16) (io.Closer, error) {
+	return forward.Forward(entry, localPort, devicePort)
+}
+
 type PortForwarder struct {
 	entry      goios.DeviceEntry
 	localPort  uint16
 	devicePort uint16
-	listener   interface{}
+	listener   io.Closer
+
+	// Verify keeps probing the driver for verifyTimeout, every verifyInterval.
+	verifyTimeout  time.Duration
+	verifyInterval time.Duration
 }
 
 func New(entry goios.DeviceEntry, localPort, devicePort uint16) *PortForwarder {
 	return &PortForwarder{
-		entry:      entry,
-		localPort:  localPort,
-		devicePort: devicePort,
+		entry:          entry,
+		localPort:      localPort,
+		devicePort:     devicePort,
+		verifyTimeout:  15 * time.Second,
+		verifyInterval: 500 * time.Millisecond,
 	}
 }
 
 func (p *PortForwarder) Start() error {
-	listener, err := forward.Forward(p.entry, p.localPort, p.devicePort)
+	forwarderMu.RLock()
+	open := forwarder
+	forwarderMu.RUnlock()
+
+	listener, err := open(p.entry, p.localPort, p.devicePort)
 	if err != nil {
-		return fmt.Errorf("port forward failed %d->%d: %w", p.localPort, p.devicePort, err)
+		return fmt.Errorf("%w %d->%d: %w", ErrForwardFailed, p.localPort, p.devicePort, err)
 	}
 	p.listener = listener
 	return nil
@@ -39,16 +76,29 @@ func (p *PortForwarder) Stop() {
 	if p.listener == nil {
 		return
 	}
-	if closer, ok := p.listener.(io.Closer); ok {
-		closer.Close()
-	}
+	p.listener.Close()
 	p.listener = nil
 }
 
-func (p *PortForwarder) Verify() error {
-	time.Sleep(500 * time.Millisecond)
-	if !utils.IsPortBusy(int(p.localPort)) {
-		return fmt.Errorf("port %d not forwarded", p.localPort)
+// Verify makes status requests through the tunnel until the driver answers
+// or the retry budget runs out. The error wraps ErrForwarderDown or
+// ErrDriverDown from the last attempt.
+func (p *PortForwarder) Verify(ctx context.Context) (*Health, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.verifyTimeout)
+	defer cancel()
+
+	attempts := 0
+	for {
+		attempts++
+		h, err := Probe(ctx, int(p.localPort))
+		if err == nil {
+			return h, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return h, fmt.Errorf("port %d: %w (%d attempts in %s)", p.localPort, err, attempts, p.verifyTimeout)
+		case <-time.After(p.verifyInterval):
+		}
 	}
-	return nil
 }
@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const bridgesDir = ".maestro/bridges"
+
+// Entry records a running bridge so other invocations can find it.
+type Entry struct {
+	UDID    string    `json:"udid"`
+	Port    int       `json:"port"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+func basePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, bridgesDir), nil
+}
+
+// Register records that this process serves udid on port.
+func Register(udid string, port int) error {
+	dir, err := basePath()
+	if err != nil {
+		return err
+	}
+	return register(dir, Entry{UDID: udid, Port: port, PID: os.Getpid(), Started: time.Now()})
+}
+
+// Unregister removes the entry for udid if this process owns it.
+func Unregister(udid string) {
+	dir, err := basePath()
+	if err != nil {
+		return
+	}
+	unregister(dir, udid, os.Getpid())
+}
+
+// List returns all live bridges, pruning entries left behind by processes
+// that no longer exist.
+func List() ([]Entry, error) {
+	dir, err := basePath()
+	if err != nil {
+		return nil, err
+	}
+	return list(dir)
+}
+
+// Lookup returns the live bridge serving udid, if any.
+func Lookup(udid string) (*Entry, bool) {
+	entries, err := List()
+	if err != nil {
+		return nil, false
+	}
+	for i := range entries {
+		if entries[i].UDID == udid {
+			return &entries[i], true
+		}
+	}
+	return nil, false
+}
+
+func register(dir string, e Entry) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(entryPath(dir, e.UDID), data, 0644)
+}
+
+func unregister(dir, udid string, pid int) {
+	e, err := readEntry(entryPath(dir, udid))
+	if err != nil || e.PID != pid {
+		return
+	}
+	os.Remove(entryPath(dir, udid))
+}
+
+func list(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		e, err := readEntry(path)
+		if err != nil || !alive(e.PID) {
+			os.Remove(path)
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].UDID < entries[j].UDID })
+	return entries, nil
+}
+
+func readEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func entryPath(dir, udid string) string {
+	return filepath.Join(dir, udid+".json")
+}
+
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
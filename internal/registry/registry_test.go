@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+
+	live := Entry{UDID: "00008030-AAA", Port: 6001, PID: os.Getpid(), Started: time.Now()}
+	stale := Entry{UDID: "00008030-BBB", Port: 6002, PID: 1 << 30, Started: time.Now()}
+	if err := register(dir, live); err != nil {
+		t.Fatal(err)
+	}
+	if err := register(dir, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := list(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].UDID != live.UDID || entries[0].Port != 6001 {
+		t.Fatalf("list() = %+v, want only the live entry", entries)
+	}
+	if _, err := os.Stat(entryPath(dir, stale.UDID)); !os.IsNotExist(err) {
+		t.Error("expected stale entry to be pruned")
+	}
+
+	// Another process's entry is left alone
+	unregister(dir, live.UDID, live.PID+1)
+	if _, err := os.Stat(entryPath(dir, live.UDID)); err != nil {
+		t.Error("entry should only be removed by its owner")
+	}
+
+	unregister(dir, live.UDID, live.PID)
+	if entries, _ := list(dir); len(entries) != 0 {
+		t.Errorf("expected no entries after unregister, got %+v", entries)
+	}
+}
+
+func TestList_MissingDir(t *testing.T) {
+	entries, err := list(t.TempDir() + "/missing")
+	if err != nil || entries != nil {
+		t.Errorf("list() = %v, %v; want nil, nil", entries, err)
+	}
+}
@@ -0,0 +1,257 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+)
+
+const (
+	cacheDir      = ".maestro/cache/builds"
+	cacheMetaFile = "meta.json"
+	stagingPrefix = ".staging-"
+	// staleStaging is how old a staging dir must be before Clean treats it
+	// as left behind by a crash rather than a build still in progress in
+	// another process. It is far longer than any sensible build timeout.
+	staleStaging = 24 * time.Hour
+)
+
+// Cache stores `build-for-testing` output keyed by everything that affects
+// it, so one build serves every later run and device with the same inputs.
+type Cache struct {
+	Root string
+}
+
+// CacheKey lists the build inputs. Its hash names the cache entry.
+type CacheKey struct {
+	RunnerHash  string `json:"runnerHash"`
+	Xcode       string `json:"xcode"`
+	TeamID      string `json:"teamId"`
+	Destination string `json:"destination"`
+}
+
+func (k CacheKey) Hash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "runner=%s\nxcode=%s\nteam=%s\ndestination=%s\n", k.RunnerHash, k.Xcode, k.TeamID, k.Destination)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+type CacheEntry struct {
+	ID      string    `json:"id"`
+	Key     CacheKey  `json:"key"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"-"`
+
+	dir string
+}
+
+// ProductsDir is the derived data path holding the built products.
+func (e *CacheEntry) ProductsDir() string {
+	return filepath.Join(e.dir, "build")
+}
+
+// DefaultCache returns the cache in ~/.maestro/cache/builds.
+func DefaultCache() (*Cache, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{Root: filepath.Join(home, cacheDir)}, nil
+}
+
+func (c *Cache) Lookup(key CacheKey) (*CacheEntry, bool) {
+	e, err := c.readEntry(filepath.Join(c.Root, key.Hash()))
+	if err != nil {
+		return nil, false
+	}
+	if _, err := findXctestrun(e.ProductsDir()); err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+// Store runs build into a staging directory and moves the result into the
+// cache once it succeeds. build receives the derived data path to use.
+func (c *Cache) Store(key CacheKey, build func(derivedData string) error) (*CacheEntry, error) {
+	if err := os.MkdirAll(c.Root, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(c.Root, stagingPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	e := &CacheEntry{ID: key.Hash(), Key: key, Created: time.Now().UTC(), dir: staging}
+	if err := build(e.ProductsDir()); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(staging, cacheMetaFile), data, 0644); err != nil {
+		return nil, err
+	}
+
+	e.dir = filepath.Join(c.Root, e.ID)
+	if err := os.Rename(staging, e.dir); err != nil {
+		// Another process stored the same key first; use theirs
+		if existing, ok := c.Lookup(key); ok {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+func (c *Cache) List() ([]CacheEntry, error) {
+	dirs, err := os.ReadDir(c.Root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		e, err := c.readEntry(filepath.Join(c.Root, d.Name()))
+		if err != nil {
+			continue
+		}
+		e.Size = dirSize(e.dir)
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.After(entries[j].Created) })
+	return entries, nil
+}
+
+// Clean removes every cached build and returns how many were removed.
+// Staging dirs of builds that may still be running are kept.
+func (c *Cache) Clean() (int, error) {
+	dirs, err := os.ReadDir(c.Root)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(d.Name(), stagingPrefix) {
+			info, err := d.Info()
+			if err != nil || time.Since(info.ModTime()) < staleStaging {
+				continue
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(c.Root, d.Name())); err != nil {
+			return removed, err
+		}
+		if !strings.HasPrefix(d.Name(), ".") {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (c *Cache) readEntry(dir string) (*CacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, cacheMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var e CacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	e.dir = dir
+	return &e, nil
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// keyLocks serialises builds of the same key within this process, so devices
+// that share signing wait for one build instead of racing.
+var keyLocks sync.Map
+
+func lockKey(hash string) func() {
+	mu, _ := keyLocks.LoadOrStore(hash, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// hashSources hashes every file in the runner project that can affect the
+// build, skipping build output and per-user Xcode state.
+func hashSources(root string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			switch name {
+			case ".git", "build", "DerivedData", "xcuserdata":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || name == ".DS_Store" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func xcodeVersion(ctx context.Context, e execx.Executor) (string, error) {
+	out, err := e.Output(ctx, "xcodebuild", "-version")
+	if err != nil {
+		return "", fmt.Errorf("failed to read Xcode version: %w", err)
+	}
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fakeBuild(derivedData string) error {
+	products := filepath.Join(derivedData, "Build", "Products")
+	if err := os.MkdirAll(products, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(products, "maestro-driver-ios_iphoneos18.0-arm64.xctestrun"), []byte("plist"), 0644)
+}
+
+func TestCache(t *testing.T) {
+	c := &Cache{Root: t.TempDir()}
+	key := CacheKey{RunnerHash: "abc", Xcode: "Xcode 16.0", TeamID: "TEAM", Destination: buildDestination}
+
+	if _, ok := c.Lookup(key); ok {
+		t.Fatal("empty cache should miss")
+	}
+
+	entry, err := c.Store(key, fakeBuild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findXctestrun(entry.ProductsDir()); err != nil {
+		t.Fatalf("stored entry has no xctestrun: %v", err)
+	}
+
+	hit, ok := c.Lookup(key)
+	if !ok || hit.ID != entry.ID {
+		t.Fatalf("Lookup() = %+v, %v; want hit for %s", hit, ok, entry.ID)
+	}
+
+	other := key
+	other.TeamID = "OTHER"
+	if _, ok := c.Lookup(other); ok {
+		t.Error("a different team should miss")
+	}
+
+	// A failed build leaves nothing behind
+	if _, err := c.Store(other, func(string) error { return errors.New("boom") }); err == nil {
+		t.Error("expected build error")
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != key || entries[0].Size == 0 {
+		t.Fatalf("List() = %+v, want the one stored entry", entries)
+	}
+
+	// A build in progress elsewhere, and one abandoned by a crash
+	building := filepath.Join(c.Root, stagingPrefix+"building")
+	abandoned := filepath.Join(c.Root, stagingPrefix+"abandoned")
+	os.MkdirAll(building, 0755)
+	os.MkdirAll(abandoned, 0755)
+	old := time.Now().Add(-2 * staleStaging)
+	os.Chtimes(abandoned, old, old)
+
+	n, err := c.Clean()
+	if err != nil || n != 1 {
+		t.Fatalf("Clean() = %d, %v; want 1", n, err)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("expected empty cache after clean, got %+v", entries)
+	}
+	if _, err := os.Stat(building); err != nil {
+		t.Errorf("Clean() removed a staging dir still in use: %v", err)
+	}
+	if _, err := os.Stat(abandoned); !os.IsNotExist(err) {
+		t.Error("Clean() kept an abandoned staging dir")
+	}
+}
+
+func TestHashSources(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.swift"), []byte("print(1)"), 0644)
+
+	before, err := hashSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build output and user state do not change the hash
+	os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	os.WriteFile(filepath.Join(dir, "build", "out.o"), []byte("x"), 0644)
+	os.MkdirAll(filepath.Join(dir, "p.xcodeproj", "xcuserdata"), 0755)
+	os.WriteFile(filepath.Join(dir, "p.xcodeproj", "xcuserdata", "state"), []byte("x"), 0644)
+	if after, _ := hashSources(dir); after != before {
+		t.Error("hash changed for ignored files")
+	}
+
+	os.WriteFile(filepath.Join(dir, "main.swift"), []byte("print(2)"), 0644)
+	if after, _ := hashSources(dir); after == before {
+		t.Error("hash did not change with sources")
+	}
+}
@@ -2,192 +2,470 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
 	"github.com/anthropics/maestro-ios-device/internal/maestro"
+	"github.com/anthropics/maestro-ios-device/internal/xclog"
 )
 
 const (
-	DevicePort     = uint16(22087)
-	buildTimeout   = 10 * time.Minute
-	startupTimeout = 90 * time.Second
+	DevicePort            = uint16(22087)
+	defaultBuildTimeout   = 10 * time.Minute
+	defaultStartupTimeout = 90 * time.Second
 )
 
 type Runner struct {
-	deviceUDID string
-	teamID     string
-	buildDir   string
-	cmd        *exec.Cmd
-	logFile    *os.File
+	deviceUDID     string
+	teamID         string
+	cache          *Cache
+	runDir         string
+	productsDir    string
+	buildTimeout   time.Duration
+	startupTimeout time.Duration
+	logPrefix      string
+	out            io.Writer
+	exec           execx.Executor
+	proc           execx.Process
+	done           chan struct{}
+	logFile        *os.File
+	starts         int
+	events         *xclog.Hub
+
+	mu      sync.Mutex
+	failure error
+	log     string
 }
 
 func New(deviceUDID, teamID string) *Runner {
 	return &Runner{
-		deviceUDID: deviceUDID,
-		teamID:     teamID,
+		deviceUDID:     deviceUDID,
+		teamID:         teamID,
+		buildTimeout:   defaultBuildTimeout,
+		startupTimeout: defaultStartupTimeout,
+		out:            os.Stdout,
+		exec:           currentExecutor(),
 	}
 }
 
+var (
+	executorMu sync.RWMutex
+	executor   execx.Executor = execx.OS{}
+)
+
+// SetExecutor replaces how runners created from now on run xcodebuild, e.g.
+// with an execx.Fake, and returns a func that restores the previous one.
+func SetExecutor(e execx.Executor) (restore func()) {
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	prev := executor
+	executor = e
+	return func() {
+		executorMu.Lock()
+		defer executorMu.Unlock()
+		executor = prev
+	}
+}
+
+func currentExecutor() execx.Executor {
+	executorMu.RLock()
+	defer executorMu.RUnlock()
+	return executor
+}
+
+// SetTimeouts overrides the build and startup timeouts. Zero keeps the default.
+func (r *Runner) SetTimeouts(build, startup time.Duration) {
+	if build > 0 {
+		r.buildTimeout = build
+	}
+	if startup > 0 {
+		r.startupTimeout = startup
+	}
+}
+
+// SetLogPrefix prefixes every progress line, so output from several runners
+// can be told apart.
+func (r *Runner) SetLogPrefix(prefix string) {
+	r.logPrefix = prefix
+}
+
+// SetOutput sends progress lines to w instead of stdout.
+func (r *Runner) SetOutput(w io.Writer) {
+	r.out = w
+}
+
+// Logf prints a line with the runner's log prefix.
+func (r *Runner) Logf(format string, args ...any) {
+	fmt.Fprintf(r.out, "%s"+format+"\n", append([]any{r.logPrefix}, args...)...)
+}
+
+// LogPath is the log of the last xcodebuild run: the build's while building,
+// the runner's once started (runner.log, then runner.2.log and so on for
+// each restart). It is empty until xcodebuild has run, and
+// removed by Cleanup but not by CleanupKeepLogs.
+func (r *Runner) LogPath() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.log
+}
+
+func (r *Runner) setLog(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = path
+}
+
+// SetCacheDir sets the build cache root (default: ~/.maestro/cache/builds).
+func (r *Runner) SetCacheDir(dir string) {
+	if dir != "" {
+		r.cache = &Cache{Root: dir}
+	}
+}
+
+var (
+	// ErrBuildFailed wraps every error from Build.
+	ErrBuildFailed = errors.New("build failed")
+	// ErrStartFailed wraps every error from Start.
+	ErrStartFailed = errors.New("start failed")
+	ErrNoXctestrun = errors.New("no xctestrun file found")
+)
+
+// Build makes sure a build-for-testing artifact exists for this runner's
+// inputs, reusing a cached one when the key matches.
 func (r *Runner) Build(ctx context.Context) error {
+	if err := r.prepare(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+	return nil
+}
+
+func (r *Runner) prepare(ctx context.Context) error {
 	runnerPath, err := maestro.GetRunnerPath()
 	if err != nil {
 		return err
 	}
 
-	r.buildDir, err = os.MkdirTemp("", "maestro-build-*")
+	if r.cache == nil {
+		if r.cache, err = DefaultCache(); err != nil {
+			return err
+		}
+	}
+
+	runDir, err := os.MkdirTemp("", "maestro-run-*")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Join(runDir, "logs"), 0755)
+	r.runDir = runDir
+
+	key, err := r.cacheKey(ctx, runnerPath)
+	if err != nil {
+		return err
+	}
+
+	unlock := lockKey(key.Hash())
+	defer unlock()
+
+	if entry, ok := r.cache.Lookup(key); ok {
+		r.productsDir = entry.ProductsDir()
+		r.Logf("♻️  Using cached build %s", entry.ID)
+		return nil
+	}
+
+	entry, err := r.cache.Store(key, func(derivedData string) error {
+		return r.build(ctx, runnerPath, derivedData)
+	})
 	if err != nil {
 		return err
 	}
+	r.productsDir = entry.ProductsDir()
 
-	os.MkdirAll(filepath.Join(r.buildDir, "logs"), 0755)
+	r.Logf("✅ Build complete")
+	return nil
+}
 
-	logPath := filepath.Join(r.buildDir, "logs", "build.log")
+func (r *Runner) cacheKey(ctx context.Context, runnerPath string) (CacheKey, error) {
+	sources, err := hashSources(runnerPath)
+	if err != nil {
+		return CacheKey{}, fmt.Errorf("failed to hash runner sources: %w", err)
+	}
+	xcode, err := xcodeVersion(ctx, r.exec)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	return CacheKey{
+		RunnerHash:  sources,
+		Xcode:       xcode,
+		TeamID:      r.teamID,
+		Destination: buildDestination,
+	}, nil
+}
+
+func (r *Runner) build(ctx context.Context, runnerPath, derivedData string) error {
+	logPath := filepath.Join(r.runDir, "logs", "build.log")
+	r.setLog(logPath)
 	logFile, err := os.Create(logPath)
 	if err != nil {
 		return err
 	}
 	defer logFile.Close()
 
-	buildCtx, cancel := context.WithTimeout(ctx, buildTimeout)
+	buildCtx, cancel := context.WithTimeout(ctx, r.buildTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(buildCtx, "xcodebuild",
+	r.Logf("🔨 Building (up to %s)...", r.buildTimeout)
+
+	err = execx.Run(buildCtx, r.exec, logFile, "xcodebuild",
 		"build-for-testing",
 		"-project", filepath.Join(runnerPath, "maestro-driver-ios.xcodeproj"),
 		"-scheme", "maestro-driver-ios",
-		"-destination", r.destination(),
-		"-derivedDataPath", r.buildOut(),
+		"-destination", buildDestination,
+		"-derivedDataPath", derivedData,
 		fmt.Sprintf("DEVELOPMENT_TEAM=%s", r.teamID),
 	)
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-
-	fmt.Println("🔨 Building (up to 10 min)...")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("build failed:\n%s\n\nFull log: %s", tailLog(logPath, 20), logPath)
-	}
-
-	if _, err := r.findXctestrun(); err != nil {
-		return err
+	if err != nil {
+		log, _ := os.ReadFile(logPath)
+		if buildCtx.Err() == context.DeadlineExceeded {
+			return &diagnose.Error{
+				Code:   diagnose.BuildTimeout,
+				Cause:  fmt.Sprintf("build did not finish in %s", r.buildTimeout),
+				Fix:    "Raise timeouts.build in the config",
+				Detail: tailLog(logPath, 20),
+				Log:    logPath,
+			}
+		}
+		return diagnose.Diagnose(string(log), diagnose.BuildFailed, "build failed", tailLog(logPath, 20), logPath)
 	}
 
-	fmt.Println("✅ Build complete")
-	return nil
+	_, err = findXctestrun(derivedData)
+	return err
 }
 
-func (r *Runner) buildOut() string {
-	return filepath.Join(r.buildDir, "build")
-}
+// buildDestination builds for any device, so one cached build serves every
+// device signed with the same team.
+const buildDestination = "generic/platform=iOS"
 
 func (r *Runner) destination() string {
 	return fmt.Sprintf("id=%s", r.deviceUDID)
 }
 
-func (r *Runner) findXctestrun() (string, error) {
-	pattern := filepath.Join(r.buildOut(), "Build", "Products", "*.xctestrun")
+// xctestrunSDK matches the SDK part of generic build products, e.g.
+// maestro-driver-ios_iphoneos17.5-arm64.xctestrun.
+var xctestrunSDK = regexp.MustCompile(`_iphoneos(\d+(?:\.\d+)*)`)
+
+// findXctestrun returns the device xctestrun in derivedData. A generic build
+// can leave one file per SDK it was built against; the newest SDK wins and
+// simulator products are ignored.
+func findXctestrun(derivedData string) (string, error) {
+	pattern := filepath.Join(derivedData, "Build", "Products", "*.xctestrun")
 	matches, _ := filepath.Glob(pattern)
-	if len(matches) == 0 {
-		return "", fmt.Errorf("no xctestrun file found")
+
+	best, bestSDK := "", ""
+	for _, m := range matches {
+		name := filepath.Base(m)
+		if strings.Contains(name, "iphonesimulator") {
+			continue
+		}
+		sdk := ""
+		if sm := xctestrunSDK.FindStringSubmatch(name); sm != nil {
+			sdk = sm[1]
+		}
+		if best == "" || maestro.CompareVersions(sdk, bestSDK) > 0 {
+			best, bestSDK = m, sdk
+		}
 	}
-	return matches[0], nil
+	if best == "" {
+		return "", ErrNoXctestrun
+	}
+	return best, nil
 }
 
+// Start launches the runner on the device from the built products and waits
+// until the driver is up.
 func (r *Runner) Start(ctx context.Context) error {
-	xctestrun, err := r.findXctestrun()
+	if err := r.start(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrStartFailed, err)
+	}
+	return nil
+}
+
+func (r *Runner) start(ctx context.Context) error {
+	xctestrun, err := findXctestrun(r.productsDir)
 	if err != nil {
 		return err
 	}
 
-	logPath := filepath.Join(r.buildDir, "logs", "runner.log")
+	// Every start gets its own log, so a restart keeps the one that
+	// explains why it was needed
+	r.starts++
+	name := "runner.log"
+	if r.starts > 1 {
+		name = fmt.Sprintf("runner.%d.log", r.starts)
+	}
+	logPath := filepath.Join(r.runDir, "logs", name)
+	r.setLog(logPath)
 	r.logFile, err = os.Create(logPath)
 	if err != nil {
 		return fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	r.cmd = exec.CommandContext(ctx, "xcodebuild",
+	// Output goes to the log and, line by line, to the event parser
+	pr, pw := io.Pipe()
+	out := io.MultiWriter(r.logFile, pw)
+
+	r.setFailure(nil)
+	r.events = xclog.NewHub()
+	startup, stopStartup := r.events.Subscribe()
+	defer stopStartup()
+	watch, _ := r.events.Subscribe()
+	go r.events.Run(xclog.Stream(pr))
+
+	r.Logf("▶️  Starting runner...")
+
+	r.proc, err = r.exec.Start(ctx, out, "xcodebuild",
 		"test-without-building",
 		"-xctestrun", xctestrun,
 		"-destination", r.destination(),
-		"-derivedDataPath", r.buildOut(),
+		"-derivedDataPath", filepath.Join(r.runDir, "derived"),
 	)
-	r.cmd.Stdout = r.logFile
-	r.cmd.Stderr = r.logFile
-
-	fmt.Println("▶️  Starting runner...")
-
-	if err := r.cmd.Start(); err != nil {
+	if err != nil {
+		pw.Close()
 		return fmt.Errorf("failed to start runner: %w", err)
 	}
-
-	if err := r.waitForStartup(logPath); err != nil {
+	r.done = make(chan struct{})
+	go func(proc execx.Process, done chan struct{}) {
+		proc.Wait()
+		pw.Close()
+		close(done)
+	}(r.proc, r.done)
+
+	if err := r.waitForStartup(logPath, startup); err != nil {
 		r.Stop()
 		return err
 	}
+	go r.watchEvents(watch, logPath)
 
-	fmt.Println("✅ Runner started")
+	r.Logf("✅ Runner started")
 	return nil
 }
 
+// Events subscribes to the running xcodebuild's parsed output. The channel
+// is closed when the runner exits; call the func to unsubscribe early.
+func (r *Runner) Events() (<-chan xclog.Event, func()) {
+	if r.events == nil {
+		ch := make(chan xclog.Event)
+		close(ch)
+		return ch, func() {}
+	}
+	return r.events.Subscribe()
+}
+
+// Failed returns the error the runner reported after startup, if any. The
+// driver's test case failing means the server behind the port is gone even
+// if xcodebuild has not exited yet.
+func (r *Runner) Failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failure
+}
+
+func (r *Runner) setFailure(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failure = err
+}
+
+func (r *Runner) watchEvents(events <-chan xclog.Event, logPath string) {
+	for ev := range events {
+		if _, err := classify(ev, logPath); err != nil {
+			r.setFailure(err)
+		}
+	}
+}
+
+// Exited is closed when the runner's xcodebuild process exits, whether it
+// crashed, lost the device or was stopped.
+func (r *Runner) Exited() <-chan struct{} {
+	return r.done
+}
+
 func (r *Runner) Stop() {
-	if r.cmd != nil && r.cmd.Process != nil {
-		r.cmd.Process.Kill()
+	if r.proc != nil {
+		r.proc.Kill()
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+		}
 	}
 	if r.logFile != nil {
 		r.logFile.Close()
 	}
 }
 
+// Cleanup stops the runner and removes this run's logs. Cached builds are kept.
 func (r *Runner) Cleanup() {
 	r.Stop()
-	if r.buildDir != "" {
-		os.RemoveAll(r.buildDir)
+	if r.runDir != "" {
+		os.RemoveAll(r.runDir)
 	}
 }
 
-func (r *Runner) waitForStartup(logPath string) error {
-	timeout := time.After(startupTimeout)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+// CleanupKeepLogs stops the runner and removes this run's derived data but
+// keeps its logs, so the log path of a failure can still be read.
+func (r *Runner) CleanupKeepLogs() {
+	r.Stop()
+	if r.runDir != "" {
+		os.RemoveAll(filepath.Join(r.runDir, "derived"))
+	}
+}
+
+func (r *Runner) waitForStartup(logPath string, events <-chan xclog.Event) error {
+	timeout := time.After(r.startupTimeout)
 
 	for {
 		select {
-		case <-ticker.C:
-			content, err := os.ReadFile(logPath)
-			if err != nil {
-				continue
+		case ev, ok := <-events:
+			if !ok {
+				log, _ := os.ReadFile(logPath)
+				return diagnose.Diagnose(string(log), diagnose.RunnerExited, "runner exited during startup", tailLog(logPath, 20), logPath)
 			}
-			if err := checkLog(string(content), logPath); err != errNotReady {
+			if ready, err := classify(ev, logPath); ready || err != nil {
 				return err
 			}
 		case <-timeout:
-			return fmt.Errorf("startup timeout (90s):\n%s\n\nFull log: %s", tailLog(logPath, 20), logPath)
+			log, _ := os.ReadFile(logPath)
+			err := diagnose.Diagnose(string(log), diagnose.StartupTimeout, fmt.Sprintf("runner did not start in %s", r.startupTimeout), tailLog(logPath, 20), logPath)
+			if err.Code == diagnose.StartupTimeout {
+				err.Fix = "Unlock the device, or raise timeouts.startup in the config"
+			}
+			return err
 		}
 	}
 }
 
-var errNotReady = fmt.Errorf("not ready")
-
-func checkLog(log, logPath string) error {
-	// Success indicators
-	if strings.Contains(log, "started") {
-		if strings.Contains(log, "Test Suite") || strings.Contains(log, "maestro-driver-ios") {
-			return nil
-		}
-	}
-	// Known errors
-	if strings.Contains(log, "Developer App Certificate is not trusted") {
-		return fmt.Errorf("certificate not trusted - trust it in Settings > General > VPN & Device Management")
-	}
-	if strings.Contains(log, "Testing failed:") {
-		return fmt.Errorf("runner failed:\n%s\n\nFull log: %s", tailLog(logPath, 20), logPath)
+// classify reports whether an output event means the driver is up, or the
+// failure it describes. Most events are neither.
+func classify(ev xclog.Event, logPath string) (ready bool, err error) {
+	switch ev.Kind {
+	case xclog.SuiteStarted, xclog.CaseStarted:
+		return true, nil
+	case xclog.TestingFailed:
+		return false, diagnose.Diagnose(ev.Message, diagnose.RunnerFailed, "runner failed", ev.Message, logPath)
+	case xclog.Error:
+		return false, diagnose.Diagnose(ev.Message, diagnose.RunnerFailed, "xcodebuild error", ev.Message, logPath)
+	case xclog.CaseFailed:
+		return false, &diagnose.Error{Code: diagnose.DriverTestFailed, Cause: fmt.Sprintf("driver test %s failed after %s", ev.Name, ev.Message), Log: logPath}
 	}
-	return errNotReady
+	return false, nil
 }
 
 func tailLog(path string, lines int) string {
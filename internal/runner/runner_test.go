@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/xclog"
+)
+
+func TestFindXctestrun(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"generic build", []string{"maestro-driver-ios_iphoneos17.5-arm64.xctestrun"}, "maestro-driver-ios_iphoneos17.5-arm64.xctestrun"},
+		{"newest SDK wins", []string{
+			"maestro-driver-ios_iphoneos17.5-arm64.xctestrun",
+			"maestro-driver-ios_iphoneos18.0-arm64.xctestrun",
+			"maestro-driver-ios_iphoneos17.10-arm64.xctestrun",
+		}, "maestro-driver-ios_iphoneos18.0-arm64.xctestrun"},
+		{"simulator ignored", []string{
+			"maestro-driver-ios_iphonesimulator18.0-arm64-x86_64.xctestrun",
+			"maestro-driver-ios_iphoneos17.5-arm64.xctestrun",
+		}, "maestro-driver-ios_iphoneos17.5-arm64.xctestrun"},
+		{"unversioned name", []string{"maestro-driver-ios.xctestrun"}, "maestro-driver-ios.xctestrun"},
+		{"simulator only", []string{"maestro-driver-ios_iphonesimulator18.0-arm64.xctestrun"}, ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			products := filepath.Join(dir, "Build", "Products")
+			os.MkdirAll(products, 0755)
+			for _, f := range tt.files {
+				os.WriteFile(filepath.Join(products, f), nil, 0644)
+			}
+
+			got, err := findXctestrun(dir)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoXctestrun) {
+					t.Errorf("findXctestrun() = %q, %v; want ErrNoXctestrun", got, err)
+				}
+				return
+			}
+			if err != nil || filepath.Base(got) != tt.want {
+				t.Errorf("findXctestrun() = %q, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name  string
+		ev    xclog.Event
+		ready bool
+		want  diagnose.Code
+	}{
+		{"suite started", xclog.Event{Kind: xclog.SuiteStarted, Name: "All tests"}, true, ""},
+		{"case started", xclog.Event{Kind: xclog.CaseStarted, Name: "x.testHttpServer"}, true, ""},
+		{"untrusted", xclog.Event{Kind: xclog.TestingFailed, Message: "The application could not be launched because the Developer App Certificate is not trusted."}, false, diagnose.CertUntrusted},
+		{"locked", xclog.Event{Kind: xclog.TestingFailed, Message: "Unable to launch com.devicelab.xctrunner because the device was not, or could not be, unlocked."}, false, diagnose.DeviceLocked},
+		{"testing failed", xclog.Event{Kind: xclog.TestingFailed, Message: "Runner encountered an error"}, false, diagnose.RunnerFailed},
+		{"no destination", xclog.Event{Kind: xclog.Error, Message: "Unable to find a destination matching the provided destination specifier:"}, false, diagnose.DeviceNotFound},
+		{"driver case failed", xclog.Event{Kind: xclog.CaseFailed, Name: "x.testHttpServer", Message: "12.000 seconds"}, false, diagnose.DriverTestFailed},
+		{"result banner", xclog.Event{Kind: xclog.Result, Message: "TEST EXECUTE FAILED"}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, err := classify(tt.ev, "runner.log")
+			switch {
+			case tt.ready:
+				if !ready || err != nil {
+					t.Errorf("classify() = %v, %v; want ready", ready, err)
+				}
+			case tt.want == "":
+				if ready || err != nil {
+					t.Errorf("classify() = %v, %v; want neither", ready, err)
+				}
+			default:
+				if code := diagnose.CodeOf(err); code != tt.want {
+					t.Errorf("classify() code = %q, want %q (%v)", code, tt.want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"strings"
+	"sync"
+)
+
+// lineBuffer keeps the last max lines written to it.
+type lineBuffer struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial string
+}
+
+func newLineBuffer(max int) *lineBuffer {
+	return &lineBuffer{max: max}
+}
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	text := b.partial + string(p)
+	lines := strings.Split(text, "\n")
+	b.partial = lines[len(lines)-1]
+	b.lines = append(b.lines, lines[:len(lines)-1]...)
+	if over := len(b.lines) - b.max; over > 0 {
+		b.lines = append(b.lines[:0:0], b.lines[over:]...)
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n complete lines.
+func (b *lineBuffer) Tail(n int) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return joinLines(b.lines[max(0, len(b.lines)-n):])
+}
+
+// tail returns the last n lines of text.
+func tail(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return joinLines(lines[max(0, len(lines)-n):])
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,435 @@
+// Package server runs bridges on request behind a local HTTP/JSON API, so a
+// test scheduler can lease devices without a terminal per bridge.
+//
+//	GET    /devices                  connected devices and their bridge port
+//	GET    /bridges                  every bridge and its state
+//	POST   /bridges                  start a bridge: {"udid", "port", "teamId"}
+//	GET    /bridges/{udid}           one bridge's state
+//	DELETE /bridges/{udid}           stop it
+//	GET    /bridges/{udid}/logs      tail its output (?lines=N&source=xcodebuild)
+//
+// POST returns as soon as the port is assigned; add ?wait=true to block
+// until the driver answers or the bridge fails.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
+)
+
+// Bridge states beyond the event kinds.
+const (
+	statePending = "pending"
+)
+
+type Server struct {
+	ctx context.Context
+	// template for every bridge; UDID, Port and TeamID come per request
+	opts bridge.Options
+	// echo receives every bridge's output besides its log buffer
+	echo io.Writer
+
+	mu      sync.Mutex
+	bridges map[string]*lease
+	// reserved holds the port of every device whose bridge is being
+	// created, so New can run without holding mu
+	reserved map[string]int
+}
+
+// lease is a bridge started through the API.
+type lease struct {
+	b       *bridge.Bridge
+	logs    *lineBuffer
+	started time.Time
+
+	mu    sync.Mutex
+	state string
+}
+
+// New returns a server whose bridges start from opts and live until ctx is
+// done or they are stopped. Their output is also copied to echo.
+func New(ctx context.Context, opts bridge.Options, echo io.Writer) *Server {
+	if echo == nil {
+		echo = io.Discard
+	}
+	return &Server{ctx: ctx, opts: opts, echo: echo, bridges: make(map[string]*lease), reserved: make(map[string]int)}
+}
+
+// Listen opens addr, which is host:port or unix:/path/to.sock. A stale
+// socket file is replaced and the new one is only accessible to this user.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("%w: %s", utils.ErrPortInUse, path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(path, 0600)
+	return ln, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", s.listDevices)
+	mux.HandleFunc("GET /bridges", s.listBridges)
+	mux.HandleFunc("POST /bridges", s.startBridge)
+	mux.HandleFunc("GET /bridges/{udid}", s.getBridge)
+	mux.HandleFunc("DELETE /bridges/{udid}", s.stopBridge)
+	mux.HandleFunc("GET /bridges/{udid}/logs", s.bridgeLogs)
+	return mux
+}
+
+// StopAll stops every bridge and waits for them.
+func (s *Server) StopAll() {
+	s.mu.Lock()
+	leases := make([]*lease, 0, len(s.bridges))
+	for _, l := range s.bridges {
+		leases = append(leases, l)
+	}
+	s.bridges = make(map[string]*lease)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, l := range leases {
+		wg.Add(1)
+		go func(l *lease) {
+			defer wg.Done()
+			l.b.Stop()
+		}(l)
+	}
+	wg.Wait()
+}
+
+// Status is a bridge as reported by the API.
+type Status struct {
+	UDID      string    `json:"udid"`
+	Name      string    `json:"name"`
+	OSVersion string    `json:"iosVersion"`
+	Port      int       `json:"port"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+func (l *lease) status() Status {
+	d := l.b.Device()
+	l.mu.Lock()
+	st := Status{UDID: d.UDID, Name: d.Name, OSVersion: d.OSVersion, Port: l.b.Port(), State: l.state, Started: l.started}
+	l.mu.Unlock()
+	if err := l.b.Err(); err != nil {
+		st.Error = err.Error()
+		st.Code = string(diagnose.CodeOf(err))
+	}
+	return st
+}
+
+func (l *lease) onEvent(ev bridge.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = string(ev.Kind)
+}
+
+type deviceStatus struct {
+	UDID       string `json:"udid"`
+	Name       string `json:"name"`
+	OSVersion  string `json:"iosVersion"`
+	Paired     bool   `json:"paired"`
+	BridgePort int    `json:"bridgePort,omitempty"`
+	State      string `json:"state,omitempty"`
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	list, err := device.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	out := make([]deviceStatus, 0, len(list))
+	for _, d := range list {
+		ds := deviceStatus{UDID: d.Serial, Name: d.Name, OSVersion: d.OSVersion, Paired: d.Paired}
+		if l := s.lookup(d.Serial); l != nil {
+			st := l.status()
+			ds.BridgePort, ds.State = st.Port, st.State
+		}
+		out = append(out, ds)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) listBridges(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	out := make([]Status, 0, len(s.bridges))
+	for _, l := range s.bridges {
+		out = append(out, l.status())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+type startRequest struct {
+	UDID   string `json:"udid"`
+	Port   int    `json:"port"`
+	TeamID string `json:"teamId"`
+}
+
+func (s *Server) startBridge(w http.ResponseWriter, r *http.Request) {
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if req.UDID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("udid is required"))
+		return
+	}
+
+	l, err := s.lease(req)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	go l.b.Start(s.ctx)
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		select {
+		case <-l.b.Ready():
+		case <-l.b.Done():
+			writeJSON(w, statusFor(l.b.Err()), l.status())
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, l.status())
+}
+
+// lease creates the bridge for req unless the device already has a live one.
+// The device and port are reserved under the lock; bridge.New, which talks
+// to the device and the keychain, runs outside it.
+func (s *Server) lease(req startRequest) (*lease, error) {
+	port, err := s.reserve(req)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lease{logs: newLineBuffer(1000), started: time.Now(), state: statePending}
+	opts := s.opts
+	opts.UDID = req.UDID
+	opts.Port = port
+	if req.TeamID != "" {
+		opts.TeamID = req.TeamID
+	}
+	opts.LogPrefix = fmt.Sprintf("[%s] ", utils.ShortUDID(req.UDID))
+	opts.Output = io.MultiWriter(l.logs, s.echo)
+	opts.OnEvent = l.onEvent
+
+	b, err := bridge.New(opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, req.UDID)
+	if err != nil {
+		return nil, err
+	}
+	l.b = b
+	s.bridges[req.UDID] = l
+	return l, nil
+}
+
+// reserve claims req's device and a port for it, replacing a bridge that is
+// already down.
+func (s *Server) reserve(req startRequest) (int, error) {
+	// Stopping tears down the runner and its logs, so the replaced bridge is
+	// stopped after the unlock below rather than holding up every request.
+	var stale *bridge.Bridge
+	defer func() {
+		if stale != nil {
+			stale.Stop()
+		}
+	}()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reserved[req.UDID]; ok {
+		return 0, fmt.Errorf("%w: %s is already being bridged", errConflict, req.UDID)
+	}
+	if old, ok := s.bridges[req.UDID]; ok {
+		select {
+		case <-old.b.Done():
+			stale = old.b
+			delete(s.bridges, req.UDID)
+		default:
+			return 0, fmt.Errorf("%w: %s is already bridged on port %d", errConflict, req.UDID, old.b.Port())
+		}
+	}
+
+	port := req.Port
+	if port == 0 {
+		var err error
+		if port, err = s.freePort(); err != nil {
+			return 0, err
+		}
+	} else if s.takenPorts()[port] {
+		return 0, fmt.Errorf("%w: %d", bridge.ErrPortInUse, port)
+	}
+	s.reserved[req.UDID] = port
+	return port, nil
+}
+
+// freePort picks a free port that no other bridge has been given yet; a
+// bridge that is still building has not bound its port.
+func (s *Server) freePort() (int, error) {
+	ports, err := utils.ResolvePorts(0, len(s.bridges)+len(s.reserved)+1)
+	if err != nil {
+		return 0, err
+	}
+	taken := s.takenPorts()
+	for _, p := range ports {
+		if !taken[p] {
+			return p, nil
+		}
+	}
+	return 0, utils.ErrNoFreePort
+}
+
+func (s *Server) takenPorts() map[int]bool {
+	taken := make(map[int]bool)
+	for _, l := range s.bridges {
+		taken[l.b.Port()] = true
+	}
+	for _, port := range s.reserved {
+		taken[port] = true
+	}
+	return taken
+}
+
+func (s *Server) lookup(udid string) *lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bridges[udid]
+}
+
+func (s *Server) getBridge(w http.ResponseWriter, r *http.Request) {
+	l := s.lookup(r.PathValue("udid"))
+	if l == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no bridge for %s", r.PathValue("udid")))
+		return
+	}
+	writeJSON(w, http.StatusOK, l.status())
+}
+
+func (s *Server) stopBridge(w http.ResponseWriter, r *http.Request) {
+	udid := r.PathValue("udid")
+	s.mu.Lock()
+	l := s.bridges[udid]
+	delete(s.bridges, udid)
+	s.mu.Unlock()
+
+	if l == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no bridge for %s", udid))
+		return
+	}
+	l.b.Stop()
+	writeJSON(w, http.StatusOK, l.status())
+}
+
+func (s *Server) bridgeLogs(w http.ResponseWriter, r *http.Request) {
+	l := s.lookup(r.PathValue("udid"))
+	if l == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no bridge for %s", r.PathValue("udid")))
+		return
+	}
+
+	lines := 100
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lines: %q", v))
+			return
+		}
+		lines = n
+	}
+
+	var text string
+	switch source := r.URL.Query().Get("source"); source {
+	case "", "bridge":
+		text = l.logs.Tail(lines)
+	case "xcodebuild":
+		path := l.b.LogPath()
+		if path == "" {
+			writeError(w, http.StatusNotFound, errors.New("xcodebuild has not run yet"))
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		text = tail(string(content), lines)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown source %q, want bridge or xcodebuild", source))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text)
+}
+
+var errConflict = errors.New("conflict")
+
+// statusFor maps a bridge error to the HTTP status the API answers with.
+func statusFor(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusGone // stopped before it was ready
+	case errors.Is(err, errConflict), errors.Is(err, bridge.ErrPortInUse), errors.Is(err, bridge.ErrAmbiguous):
+		return http.StatusConflict
+	case errors.Is(err, bridge.ErrDeviceNotFound), errors.Is(err, bridge.ErrNoDevices):
+		return http.StatusNotFound
+	case errors.Is(err, utils.ErrNoFreePort):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error(), Code: string(diagnose.CodeOf(err))})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/fakemac"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/pkg/bridge"
+)
+
+const testUDID = fakemac.UDID
+
+// newTestServer serves the API over a fake Mac with one connected iPhone.
+// The returned fake scripts xcodebuild.
+func newTestServer(t *testing.T) (*httptest.Server, *execx.Fake) {
+	t.Helper()
+
+	mac := fakemac.New(t)
+	srv := New(context.Background(), bridge.Options{TeamID: "TEAM123456"}, nil)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(srv.StopAll)
+	t.Cleanup(ts.Close)
+	return ts, mac.Exec
+}
+
+// call sends a request and decodes the JSON answer into out, if given.
+func call(t *testing.T, method, url, body string, out any) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var st Status
+	if code := call(t, "POST", ts.URL+"/bridges?wait=true", `{"udid":"`+testUDID+`"}`, &st); code != http.StatusCreated {
+		t.Fatalf("POST /bridges = %d, want 201 (%+v)", code, st)
+	}
+	if st.State != "ready" || st.Port == 0 || st.Name != "Test iPhone" {
+		t.Errorf("started bridge = %+v, want ready with a port", st)
+	}
+	if _, err := portforward.Probe(context.Background(), st.Port); err != nil {
+		t.Errorf("driver not reachable on port %d: %v", st.Port, err)
+	}
+
+	var devices []deviceStatus
+	call(t, "GET", ts.URL+"/devices", "", &devices)
+	if len(devices) != 1 || devices[0].BridgePort != st.Port {
+		t.Errorf("GET /devices = %+v, want bridge port %d", devices, st.Port)
+	}
+
+	var list []Status
+	call(t, "GET", ts.URL+"/bridges", "", &list)
+	if len(list) != 1 || list[0].UDID != testUDID {
+		t.Errorf("GET /bridges = %+v, want the started bridge", list)
+	}
+
+	var conflict errorResponse
+	if code := call(t, "POST", ts.URL+"/bridges", `{"udid":"`+testUDID+`"}`, &conflict); code != http.StatusConflict {
+		t.Errorf("second POST /bridges = %d, want 409 (%s)", code, conflict.Error)
+	}
+
+	resp, err := http.Get(ts.URL + "/bridges/" + testUDID + "/logs?lines=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(logs), "Runner started") {
+		t.Errorf("logs = %q, want the runner's progress", logs)
+	}
+
+	if code := call(t, "DELETE", ts.URL+"/bridges/"+testUDID, "", &st); code != http.StatusOK || st.State != "stopped" {
+		t.Errorf("DELETE = %d %+v, want 200 and stopped", code, st)
+	}
+	if code := call(t, "GET", ts.URL+"/bridges/"+testUDID, "", nil); code != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want 404", code)
+	}
+
+	// The device can be leased again
+	if code := call(t, "POST", ts.URL+"/bridges?wait=true", `{"udid":"`+testUDID+`"}`, &st); code != http.StatusCreated {
+		t.Errorf("POST after DELETE = %d, want 201 (%+v)", code, st)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/bridges", `{}`, http.StatusBadRequest},
+		{"POST", "/bridges", `not json`, http.StatusBadRequest},
+		{"POST", "/bridges", `{"udid":"00008101-AAAA"}`, http.StatusNotFound},
+		{"GET", "/bridges/00008101-AAAA", "", http.StatusNotFound},
+		{"DELETE", "/bridges/00008101-AAAA", "", http.StatusNotFound},
+		{"GET", "/bridges/00008101-AAAA/logs", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var resp errorResponse
+		if code := call(t, tt.method, ts.URL+tt.path, tt.body, &resp); code != tt.want || resp.Error == "" {
+			t.Errorf("%s %s %s = %d %+v, want %d with an error", tt.method, tt.path, tt.body, code, resp, tt.want)
+		}
+	}
+}
+
+func TestServer_ConcurrentStart(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	codes := make(chan int, 5)
+	for range cap(codes) {
+		go func() {
+			codes <- call(t, "POST", ts.URL+"/bridges", `{"udid":"`+testUDID+`"}`, nil)
+		}()
+	}
+	created := 0
+	for range cap(codes) {
+		switch code := <-codes; code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("POST /bridges = %d, want 201 or 409", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d bridges created for one device, want 1", created)
+	}
+}
+
+func TestServer_FailedBridgeLogs(t *testing.T) {
+	ts, fake := newTestServer(t)
+	fake.Handle("xcodebuild", func(ctx context.Context, args []string, out io.Writer) error {
+		if args[0] == "-version" {
+			fmt.Fprintln(out, "Xcode 16.2")
+			return nil
+		}
+		fmt.Fprintln(out, `error: No Account for Team "TEAM123456".`)
+		fmt.Fprintln(out, "** TEST BUILD FAILED **")
+		return &execx.ExitError{Code: 65}
+	})
+
+	var st Status
+	if code := call(t, "POST", ts.URL+"/bridges?wait=true", `{"udid":"`+testUDID+`"}`, &st); code != http.StatusInternalServerError || st.State != "failed" {
+		t.Fatalf("POST /bridges = %d %+v, want 500 and failed", code, st)
+	}
+
+	resp, err := http.Get(ts.URL + "/bridges/" + testUDID + "/logs?source=xcodebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(logs), "TEST BUILD FAILED") {
+		t.Errorf("xcodebuild logs = %d %q, want 200 and the failed build's output", resp.StatusCode, logs)
+	}
+}
+
+func TestLineBuffer(t *testing.T) {
+	b := newLineBuffer(3)
+	io.WriteString(b, "one\ntwo\nthr")
+	io.WriteString(b, "ee\nfour\nfive")
+
+	if got, want := b.Tail(10), "two\nthree\nfour\n"; got != want {
+		t.Errorf("Tail(10) = %q, want %q", got, want)
+	}
+	if got, want := b.Tail(1), "four\n"; got != want {
+		t.Errorf("Tail(1) = %q, want %q", got, want)
+	}
+	if got, want := tail("a\nb\nc\n", 2), "b\nc\n"; got != want {
+		t.Errorf("tail = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package shard
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Suites is a JUnit report.
+type Suites struct {
+	XMLName  xml.Name `xml:"testsuites"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Tests    int      `xml:"tests,attr"`
+	Failures int      `xml:"failures,attr"`
+	Errors   int      `xml:"errors,attr"`
+	Time     string   `xml:"time,attr,omitempty"`
+	Suites   []Suite  `xml:"testsuite"`
+}
+
+type Suite struct {
+	Name       string     `xml:"name,attr"`
+	Tests      int        `xml:"tests,attr"`
+	Failures   int        `xml:"failures,attr"`
+	Errors     int        `xml:"errors,attr"`
+	Time       string     `xml:"time,attr,omitempty"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+	Properties []Property `xml:"properties>property,omitempty"`
+	Cases      []Case     `xml:"testcase"`
+}
+
+type Case struct {
+	Name       string     `xml:"name,attr"`
+	Classname  string     `xml:"classname,attr,omitempty"`
+	Time       string     `xml:"time,attr,omitempty"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+	Properties []Property `xml:"properties>property,omitempty"`
+	Failure    *Message   `xml:"failure"`
+	Error      *Message   `xml:"error"`
+	Skipped    *Message   `xml:"skipped"`
+	// Earlier failed attempts, as Surefire reports reruns
+	FlakyFailures []Message `xml:"flakyFailure"`
+	RerunFailures []Message `xml:"rerunFailure"`
+}
+
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type Message struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// ReadCases returns the test cases in a JUnit file, whether its root is
+// <testsuites> or a single <testsuite>.
+func ReadCases(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var all Suites
+	if err := xml.Unmarshal(data, &all); err == nil {
+		var cases []Case
+		for _, s := range all.Suites {
+			cases = append(cases, s.Cases...)
+		}
+		return cases, nil
+	}
+	var one Suite
+	if err := xml.Unmarshal(data, &one); err != nil {
+		return nil, fmt.Errorf("invalid JUnit report %s: %w", path, err)
+	}
+	return one.Cases, nil
+}
+
+// Merge builds one report from the results: a suite per device, named by
+// labels[worker], with each case tagged with the device it ran on. Failed
+// attempts before the last are <flakyFailure>s of a flow that passed on a
+// retry, and <rerunFailure>s of one that never passed; the runner log kept
+// for each failed attempt is an attempt.<n>.runner.log property. Flows that
+// never ran are errors in a final "not run" suite.
+func Merge(results []Result, labels map[string]string) *Suites {
+	report := &Suites{Name: "maestro-ios-device"}
+	suites := make(map[string]*Suite)
+	var order []string
+	var total float64
+
+	for _, r := range results {
+		key := r.Worker
+		s, ok := suites[key]
+		if !ok {
+			s = &Suite{Name: "not run"}
+			if key != "" {
+				s.Name = labels[key]
+				if s.Name == "" {
+					s.Name = key
+				}
+				s.Properties = []Property{{Name: "device.udid", Value: key}}
+			}
+			suites[key] = s
+			order = append(order, key)
+		}
+
+		for _, c := range casesFor(r) {
+			if key != "" {
+				c.Properties = append(c.Properties, Property{Name: "device.udid", Value: key})
+			}
+			if len(r.Previous) > 0 {
+				c.Properties = append(c.Properties, Property{Name: "attempts", Value: strconv.Itoa(len(r.Previous) + 1)})
+				for _, p := range r.Previous {
+					m := Message{Message: failureMessage(p)}
+					if r.Outcome == Flaky {
+						c.FlakyFailures = append(c.FlakyFailures, m)
+					} else {
+						c.RerunFailures = append(c.RerunFailures, m)
+					}
+				}
+			}
+			for i, a := range append(r.Previous, r.Attempt) {
+				if a.Log != "" {
+					c.Properties = append(c.Properties, Property{Name: fmt.Sprintf("attempt.%d.runner.log", i+1), Value: a.Log})
+				}
+			}
+			s.Tests++
+			switch {
+			case c.Failure != nil:
+				s.Failures++
+			case c.Error != nil:
+				s.Errors++
+			}
+			t, _ := strconv.ParseFloat(c.Time, 64)
+			total += t
+			s.Cases = append(s.Cases, c)
+		}
+	}
+
+	// Devices first, leftovers last
+	for _, key := range order {
+		if key != "" {
+			report.Suites = append(report.Suites, *suites[key])
+		}
+	}
+	if s, ok := suites[""]; ok {
+		report.Suites = append(report.Suites, *s)
+	}
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+	}
+	report.Time = strconv.FormatFloat(total, 'f', 3, 64)
+	return report
+}
+
+// casesFor returns the cases Maestro reported for r, or one made up from
+// the outcome when there is no usable report.
+func casesFor(r Result) []Case {
+	if r.Report != "" {
+		if cases, err := ReadCases(r.Report); err == nil && len(cases) > 0 {
+			return cases
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(r.Flow), filepath.Ext(r.Flow))
+	c := Case{Name: name, Classname: name}
+	msg := r.Outcome.String()
+	if r.Err != nil {
+		msg = r.Err.Error()
+	}
+	switch r.Outcome {
+	case Failed:
+		c.Failure = &Message{Message: msg}
+	case NotRun, DeviceLost:
+		if len(r.Lost) > 0 {
+			msg = fmt.Sprintf("%s (lost %s)", msg, strings.Join(r.Lost, ", "))
+		}
+		c.Error = &Message{Message: msg}
+	}
+	return []Case{c}
+}
+
+// failureMessage says why a failed attempt failed, preferring Maestro's own
+// words from its report.
+func failureMessage(a Attempt) string {
+	if a.Report != "" {
+		if cases, err := ReadCases(a.Report); err == nil {
+			for _, c := range cases {
+				for _, m := range []*Message{c.Failure, c.Error} {
+					if m == nil {
+						continue
+					}
+					if text := strings.TrimSpace(m.Text); text != "" {
+						return text
+					}
+					if m.Message != "" {
+						return m.Message
+					}
+				}
+			}
+		}
+	}
+	if a.Err != nil {
+		return a.Err.Error()
+	}
+	return a.Outcome.String()
+}
+
+// Write writes the report as XML.
+func (s *Suites) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,224 @@
+// Package shard spreads Maestro flows over several devices. Flows are handed
+// out one at a time to whichever device is free, and a flow whose device is
+// lost goes back on the queue for the devices that are left. A failed flow
+// can be retried on the same device after resetting its runner.
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNoFlows = errors.New("no flows found")
+
+// Discover expands paths into flow files. A directory contributes the
+// .yaml/.yml files directly inside it, except Maestro's config.yaml, like
+// `maestro test <dir>` does.
+func Discover(paths []string) ([]string, error) {
+	var flows []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			flows = append(flows, p)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || (ext != ".yaml" && ext != ".yml") || strings.TrimSuffix(e.Name(), ext) == "config" {
+				continue
+			}
+			found = append(found, filepath.Join(p, e.Name()))
+		}
+		sort.Strings(found)
+		flows = append(flows, found...)
+	}
+
+	if len(flows) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoFlows, strings.Join(paths, ", "))
+	}
+	return flows, nil
+}
+
+type Outcome int
+
+const (
+	Passed Outcome = iota
+	// Flaky means the flow failed, then passed on a retry.
+	Flaky
+	Failed
+	// DeviceLost means the device, not the flow, failed: the flow is
+	// requeued and the worker gets no more flows.
+	DeviceLost
+	// NotRun is reported for flows left over when every device was lost or
+	// the run was cancelled.
+	NotRun
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Passed:
+		return "passed"
+	case Flaky:
+		return "flaky"
+	case Failed:
+		return "failed"
+	case DeviceLost:
+		return "device lost"
+	}
+	return "not run"
+}
+
+// Attempt is one run of a flow on one device.
+type Attempt struct {
+	Outcome Outcome
+	// Report is the JUnit file Maestro wrote, if any.
+	Report string
+	// Log is a copy of the runner's log for a failed attempt, if kept.
+	Log string
+	Err error
+	// Previous holds the failed attempts before this one, oldest first.
+	Previous []Attempt
+}
+
+// Worker runs flows on one device.
+type Worker interface {
+	// Name identifies the device, e.g. its UDID.
+	Name() string
+	Run(ctx context.Context, flow string) Attempt
+	// Reset gives the next flow a fresh runner. An error means the device
+	// is lost.
+	Reset(ctx context.Context) error
+}
+
+// Result is where a flow finally ran and how it went.
+type Result struct {
+	Flow   string
+	Worker string // empty when NotRun
+	Attempt
+	// Lost lists the workers the flow was running on when their device was lost.
+	Lost []string
+}
+
+// Run hands flows to workers until every flow has a result or ctx is done.
+// A failed flow is retried up to retries times on the same worker, after a
+// Reset. Results are in the order of flows.
+func Run(ctx context.Context, workers []Worker, flows []string, retries int) []Result {
+	q := &queue{pending: make([]int, len(flows)), results: make([]Result, len(flows))}
+	q.cond = sync.NewCond(&q.mu)
+	for i, f := range flows {
+		q.pending[i] = i
+		q.results[i] = Result{Flow: f, Attempt: Attempt{Outcome: NotRun}}
+	}
+
+	stop := context.AfterFunc(ctx, q.wake)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w Worker) {
+			defer wg.Done()
+			for {
+				i, ok := q.next(ctx)
+				if !ok {
+					return
+				}
+				a := runFlow(ctx, w, flows[i], retries)
+				if !q.finish(ctx, i, w.Name(), a) {
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	return q.results
+}
+
+// runFlow runs flow on w until it passes, it has failed retries+1 times or
+// the device is lost.
+func runFlow(ctx context.Context, w Worker, flow string, retries int) Attempt {
+	var failed []Attempt
+	for {
+		a := w.Run(ctx, flow)
+		if a.Outcome != Failed || len(failed) == retries || ctx.Err() != nil {
+			if a.Outcome == Passed && len(failed) > 0 {
+				a.Outcome = Flaky
+			}
+			a.Previous = failed
+			return a
+		}
+
+		failed = append(failed, a)
+		if err := w.Reset(ctx); err != nil {
+			return Attempt{Outcome: DeviceLost, Err: fmt.Errorf("could not reset runner for a retry: %w", err), Previous: failed}
+		}
+	}
+}
+
+type queue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []int // indexes into results
+	inFlight int
+	results  []Result
+}
+
+// next blocks until there is a flow to run. It gives up once the queue is
+// empty and no running flow can be requeued, or ctx is done.
+func (q *queue) next(ctx context.Context) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && q.inFlight > 0 && ctx.Err() == nil {
+		q.cond.Wait()
+	}
+	if len(q.pending) == 0 || ctx.Err() != nil {
+		return 0, false
+	}
+	i := q.pending[0]
+	q.pending = q.pending[1:]
+	q.inFlight++
+	return i, true
+}
+
+// finish records an attempt and reports whether the worker should go on.
+func (q *queue) finish(ctx context.Context, i int, worker string, a Attempt) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.cond.Broadcast()
+	q.inFlight--
+
+	r := &q.results[i]
+	if a.Outcome == DeviceLost || ctx.Err() != nil {
+		if a.Outcome == DeviceLost {
+			r.Lost = append(r.Lost, worker)
+			r.Err = a.Err
+		}
+		// Retry it first, on another device
+		q.pending = append([]int{i}, q.pending...)
+		return a.Outcome != DeviceLost
+	}
+	r.Worker = worker
+	r.Attempt = a
+	return true
+}
+
+func (q *queue) wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+}
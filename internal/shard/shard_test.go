@@ -0,0 +1,204 @@
+package shard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yaml", "a.yml", "config.yaml", "notes.md"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.MkdirAll(filepath.Join(dir, "subflows"), 0755)
+	os.WriteFile(filepath.Join(dir, "subflows", "login.yaml"), nil, 0644)
+	single := filepath.Join(t.TempDir(), "smoke.yaml")
+	os.WriteFile(single, nil, 0644)
+
+	got, err := Discover([]string{dir, single})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yaml"), single}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, want %v", got, want)
+	}
+
+	if _, err := Discover([]string{t.TempDir()}); !errors.Is(err, ErrNoFlows) {
+		t.Errorf("Discover(empty dir) = %v, want ErrNoFlows", err)
+	}
+}
+
+// fakeWorker fails flows listed in fail the given number of times, and
+// loses its device on the first flow once lose is set.
+type fakeWorker struct {
+	name string
+	fail map[string]int
+	lose bool
+
+	mu     sync.Mutex
+	ran    []string
+	resets int
+}
+
+func (w *fakeWorker) Name() string { return w.name }
+
+func (w *fakeWorker) Run(_ context.Context, flow string) Attempt {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ran = append(w.ran, flow)
+	switch {
+	case w.lose:
+		return Attempt{Outcome: DeviceLost, Err: errors.New("device unplugged")}
+	case w.fail[flow] > 0:
+		w.fail[flow]--
+		return Attempt{Outcome: Failed, Err: fmt.Errorf("%s failed", flow)}
+	}
+	return Attempt{Outcome: Passed}
+}
+
+func (w *fakeWorker) Reset(context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resets++
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	flows := []string{"a.yaml", "b.yaml", "c.yaml", "d.yaml", "e.yaml"}
+
+	t.Run("spreads flows", func(t *testing.T) {
+		w1 := &fakeWorker{name: "one", fail: map[string]int{"c.yaml": 1}}
+		w2 := &fakeWorker{name: "two", fail: map[string]int{"c.yaml": 1}}
+
+		results := Run(context.Background(), []Worker{w1, w2}, flows, 0)
+		for i, r := range results {
+			want := Passed
+			if r.Flow == "c.yaml" {
+				want = Failed
+			}
+			if r.Flow != flows[i] || r.Outcome != want || r.Worker == "" {
+				t.Errorf("result %d = %+v, want %s %s", i, r, flows[i], want)
+			}
+		}
+		if len(w1.ran)+len(w2.ran) != len(flows) {
+			t.Errorf("ran %v and %v, want every flow once", w1.ran, w2.ran)
+		}
+	})
+
+	t.Run("requeues a lost device's flows", func(t *testing.T) {
+		lost := &fakeWorker{name: "lost", lose: true}
+		healthy := &fakeWorker{name: "healthy"}
+
+		results := Run(context.Background(), []Worker{lost, healthy}, flows, 0)
+		for _, r := range results {
+			if r.Outcome != Passed || r.Worker != "healthy" {
+				t.Errorf("%s = %s on %q, want passed on healthy", r.Flow, r.Outcome, r.Worker)
+			}
+		}
+		if len(lost.ran) > 1 {
+			t.Errorf("lost device ran %v, want at most one flow before it was retired", lost.ran)
+		}
+		for _, r := range results {
+			if len(r.Lost) > 0 && (r.Lost[0] != "lost" || r.Flow != lost.ran[0]) {
+				t.Errorf("%s lost on %v, want only %v on lost", r.Flow, r.Lost, lost.ran)
+			}
+		}
+	})
+
+	t.Run("every device lost", func(t *testing.T) {
+		results := Run(context.Background(), []Worker{&fakeWorker{name: "one", lose: true}, &fakeWorker{name: "two", lose: true}}, flows, 0)
+		for _, r := range results {
+			if r.Outcome != NotRun {
+				t.Errorf("%s = %s, want not run", r.Flow, r.Outcome)
+			}
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for _, r := range Run(ctx, []Worker{&fakeWorker{name: "one"}}, flows, 0) {
+			if r.Outcome != NotRun {
+				t.Errorf("%s = %s after cancel, want not run", r.Flow, r.Outcome)
+			}
+		}
+	})
+}
+
+func TestRun_Retries(t *testing.T) {
+	w := &fakeWorker{name: "one", fail: map[string]int{"flaky.yaml": 2, "broken.yaml": 5}}
+
+	results := Run(context.Background(), []Worker{w}, []string{"flaky.yaml", "broken.yaml", "fine.yaml"}, 2)
+
+	want := []struct {
+		outcome  Outcome
+		previous int
+	}{{Flaky, 2}, {Failed, 2}, {Passed, 0}}
+	for i, r := range results {
+		if r.Outcome != want[i].outcome || len(r.Previous) != want[i].previous {
+			t.Errorf("%s = %s after %d failed attempt(s), want %s after %d", r.Flow, r.Outcome, len(r.Previous), want[i].outcome, want[i].previous)
+		}
+	}
+	if w.resets != 4 {
+		t.Errorf("runner reset %d times, want once before each of the 4 retries", w.resets)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	results := []Result{
+		{Flow: "flows/checkout.yaml", Worker: "UDID-1", Attempt: Attempt{Outcome: Failed, Report: "testdata/maestro-junit.xml"}},
+		{Flow: "flows/search.yaml", Worker: "UDID-2", Attempt: Attempt{Outcome: Failed, Err: errors.New("exit status 1")}},
+		{Flow: "flows/profile.yaml", Attempt: Attempt{Outcome: NotRun, Err: errors.New("device unplugged")}, Lost: []string{"UDID-2"}},
+		{Flow: "flows/login.yaml", Worker: "UDID-2", Attempt: Attempt{Outcome: Flaky, Previous: []Attempt{
+			{Outcome: Failed, Report: "testdata/maestro-junit.xml"},
+		}}},
+	}
+	report := Merge(results, map[string]string{"UDID-1": "iPhone 15 (UDID-1)"})
+
+	if report.Tests != 5 || report.Failures != 2 || report.Errors != 1 {
+		t.Errorf("totals = %d tests, %d failures, %d errors; want 5, 2, 1", report.Tests, report.Failures, report.Errors)
+	}
+	var names []string
+	for _, s := range report.Suites {
+		names = append(names, s.Name)
+	}
+	if want := []string{"iPhone 15 (UDID-1)", "UDID-2", "not run"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("suites = %v, want %v", names, want)
+	}
+	if c := report.Suites[0].Cases[1]; c.Name != "Checkout" || c.Failure == nil || c.Properties[0].Value != "UDID-1" {
+		t.Errorf("case = %+v, want Checkout failed on UDID-1", c)
+	}
+	if c := report.Suites[2].Cases[0]; c.Name != "profile" || c.Error == nil || !strings.Contains(c.Error.Message, "lost UDID-2") {
+		t.Errorf("not run case = %+v", c)
+	}
+
+	if c := report.Suites[1].Cases[1]; c.Name != "login" || c.Failure != nil || len(c.FlakyFailures) != 1 || c.FlakyFailures[0].Message != "Element not found: Text matching regex: Pay" {
+		t.Errorf("flaky case = %+v, want passed with the earlier failure", c)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "report.xml")
+	os.WriteFile(path, buf.Bytes(), 0644)
+	cases, err := ReadCases(path)
+	if err != nil || len(cases) != 5 {
+		t.Errorf("ReadCases(merged) = %d cases, %v; want 5", len(cases), err)
+	}
+	if !strings.Contains(buf.String(), "<flakyFailure") {
+		t.Error("merged report has no flakyFailure")
+	}
+	if !strings.Contains(buf.String(), `status="SUCCESS"`) {
+		t.Error("merged report lost Maestro's own testcase attributes")
+	}
+}
@@ -0,0 +1,280 @@
+// Package signing finds the Apple Developer Team ID from the code-signing
+// identities in the keychain and the installed provisioning profiles. Parsing
+// is pure Go so it can be tested on any platform; only Teams runs security,
+// through an executor tests can replace.
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" // #nosec G505 -- keychain identities are keyed by SHA-1
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+)
+
+// Identity is a code-signing identity as listed by `security find-identity`.
+type Identity struct {
+	Hash string
+	Name string
+}
+
+// Profile holds the fields we need from a .mobileprovision file.
+type Profile struct {
+	Name                 string    `plist:"Name"`
+	UUID                 string    `plist:"UUID"`
+	TeamIdentifier       []string  `plist:"TeamIdentifier"`
+	TeamName             string    `plist:"TeamName"`
+	ExpirationDate       time.Time `plist:"ExpirationDate"`
+	ProvisionedDevices   []string  `plist:"ProvisionedDevices"`
+	ProvisionsAllDevices bool      `plist:"ProvisionsAllDevices"`
+}
+
+// Team is a candidate team and where it was found.
+type Team struct {
+	ID       string
+	Name     string
+	Identity string
+	Profiles int
+}
+
+var (
+	ErrNoTeam        = errors.New("no code-signing identity with a Team ID found")
+	ErrMultipleTeams = errors.New("multiple teams found")
+)
+
+var identityPattern = regexp.MustCompile(`^\s*\d+\)\s+([0-9A-F]{40})\s+"(.+)"`)
+
+// ParseIdentities parses `security find-identity -v -p codesigning` output.
+func ParseIdentities(out string) []Identity {
+	var ids []Identity
+	for _, line := range strings.Split(out, "\n") {
+		if m := identityPattern.FindStringSubmatch(line); m != nil {
+			ids = append(ids, Identity{Hash: m[1], Name: m[2]})
+		}
+	}
+	return ids
+}
+
+// TeamsFromCertificates returns the team ID (the subject's OU) of every PEM
+// certificate in data whose SHA-1 matches one of the identities, keyed by
+// identity hash.
+func TeamsFromCertificates(data []byte, ids []Identity) map[string]string {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id.Hash] = true
+	}
+
+	teams := make(map[string]string)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		sum := sha1.Sum(block.Bytes) // #nosec G401
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		if !wanted[hash] {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || len(cert.Subject.OrganizationalUnit) == 0 {
+			continue
+		}
+		teams[hash] = cert.Subject.OrganizationalUnit[0]
+	}
+	return teams
+}
+
+// ParseProfile decodes a CMS-signed provisioning profile. The signature is
+// not verified; we only read the embedded plist.
+func ParseProfile(data []byte) (*Profile, error) {
+	content := data
+	if p7, err := pkcs7.Parse(data); err == nil {
+		content = p7.Content
+	} else if start, end := bytes.Index(data, []byte("<?xml")), bytes.LastIndex(data, []byte("</plist>")); start != -1 && end > start {
+		// Not valid DER; the plist is still stored in clear text inside
+		content = data[start : end+len("</plist>")]
+	}
+
+	var p Profile
+	if _, err := plist.Unmarshal(content, &p); err != nil {
+		return nil, fmt.Errorf("invalid provisioning profile: %w", err)
+	}
+	if len(p.TeamIdentifier) == 0 {
+		return nil, fmt.Errorf("provisioning profile has no TeamIdentifier")
+	}
+	return &p, nil
+}
+
+// LoadProfiles parses every .mobileprovision file in dirs, skipping
+// unreadable ones.
+func LoadProfiles(dirs ...string) []Profile {
+	var profiles []Profile
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.mobileprovision"))
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if p, err := ParseProfile(data); err == nil {
+				profiles = append(profiles, *p)
+			}
+		}
+	}
+	return profiles
+}
+
+// Candidates combines identities and profiles into the list of usable teams.
+// A team needs a signing identity; when any team also has an unexpired
+// profile, teams without one are dropped.
+func Candidates(ids []Identity, certTeams map[string]string, profiles []Profile, now time.Time) []Team {
+	byID := make(map[string]*Team)
+	var order []string
+	for _, id := range ids {
+		teamID := certTeams[id.Hash]
+		if teamID == "" {
+			continue
+		}
+		if _, ok := byID[teamID]; !ok {
+			byID[teamID] = &Team{ID: teamID, Identity: id.Name}
+			order = append(order, teamID)
+		}
+	}
+
+	withProfile := 0
+	for _, p := range profiles {
+		if !p.ExpirationDate.IsZero() && p.ExpirationDate.Before(now) {
+			continue
+		}
+		for _, teamID := range p.TeamIdentifier {
+			if t, ok := byID[teamID]; ok {
+				if t.Profiles == 0 {
+					withProfile++
+				}
+				t.Profiles++
+				if t.Name == "" {
+					t.Name = p.TeamName
+				}
+			}
+		}
+	}
+
+	teams := make([]Team, 0, len(order))
+	for _, teamID := range order {
+		t := byID[teamID]
+		if withProfile > 0 && t.Profiles == 0 {
+			continue
+		}
+		teams = append(teams, *t)
+	}
+	sort.SliceStable(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+	return teams
+}
+
+// Choose returns the only candidate, or an error listing them.
+func Choose(teams []Team) (*Team, error) {
+	switch len(teams) {
+	case 1:
+		return &teams[0], nil
+	case 0:
+		return nil, fmt.Errorf("%w. Sign in to your Apple ID in Xcode → Settings → Accounts, or pass --team-id", ErrNoTeam)
+	}
+
+	var b strings.Builder
+	for _, t := range teams {
+		fmt.Fprintf(&b, "\n  %s  %s", t.ID, t.describe())
+	}
+	return nil, fmt.Errorf("%w, pass --team-id:%s", ErrMultipleTeams, b.String())
+}
+
+func (t Team) describe() string {
+	if t.Name != "" {
+		return fmt.Sprintf("%s (%s)", t.Name, t.Identity)
+	}
+	return t.Identity
+}
+
+// ProfileDirs returns the directories Xcode stores provisioning profiles in.
+func ProfileDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, "Library", "MobileDevice", "Provisioning Profiles"),
+		filepath.Join(home, "Library", "Developer", "Xcode", "UserData", "Provisioning Profiles"),
+	}
+}
+
+var (
+	executorMu sync.RWMutex
+	executor   execx.Executor = execx.OS{}
+)
+
+// SetExecutor replaces how Teams runs security, e.g. with an execx.Fake, and
+// returns a func that restores the previous one.
+func SetExecutor(e execx.Executor) (restore func()) {
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	prev := executor
+	executor = e
+	return func() {
+		executorMu.Lock()
+		defer executorMu.Unlock()
+		executor = prev
+	}
+}
+
+func currentExecutor() execx.Executor {
+	executorMu.RLock()
+	defer executorMu.RUnlock()
+	return executor
+}
+
+// Teams reads the keychain and installed profiles and returns the candidate teams.
+func Teams() ([]Team, error) {
+	e := currentExecutor()
+	out, err := e.Output(context.Background(), "security", "find-identity", "-v", "-p", "codesigning")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing identities: %w", err)
+	}
+	ids := ParseIdentities(string(out))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	certs, err := e.Output(context.Background(), "security", "find-certificate", "-a", "-p")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificates: %w", err)
+	}
+
+	return Candidates(ids, TeamsFromCertificates(certs, ids), LoadProfiles(ProfileDirs()...), time.Now()), nil
+}
+
+// Detect returns the Team ID to sign with when exactly one team qualifies.
+func Detect() (*Team, error) {
+	teams, err := Teams()
+	if err != nil {
+		return nil, err
+	}
+	return Choose(teams)
+}
@@ -0,0 +1,170 @@
+package signing
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseIdentities(t *testing.T) {
+	ids := ParseIdentities(string(readFixture(t, "find-identity.txt")))
+	if len(ids) != 2 {
+		t.Fatalf("got %d identities, want 2", len(ids))
+	}
+	if ids[0].Name != "Apple Development: Jane Doe (PERSON1234)" || len(ids[0].Hash) != 40 {
+		t.Errorf("unexpected identity: %+v", ids[0])
+	}
+
+	if got := ParseIdentities("     0 valid identities found"); len(got) != 0 {
+		t.Errorf("expected no identities, got %v", got)
+	}
+}
+
+func TestTeamsFromCertificates(t *testing.T) {
+	ids := ParseIdentities(string(readFixture(t, "find-identity.txt")))
+	teams := TeamsFromCertificates(readFixture(t, "certificates.pem"), ids)
+
+	// The team comes from the certificate OU, not the ID in the identity name
+	if got := teams[ids[0].Hash]; got != "TEAMAAAAAA" {
+		t.Errorf("team for %s = %q, want %q", ids[0].Name, got, "TEAMAAAAAA")
+	}
+	if got := teams[ids[1].Hash]; got != "TEAMBBBBBB" {
+		t.Errorf("team for %s = %q, want %q", ids[1].Name, got, "TEAMBBBBBB")
+	}
+
+	if got := TeamsFromCertificates(readFixture(t, "certificates.pem"), ids[:1]); len(got) != 1 {
+		t.Errorf("expected only requested identities, got %v", got)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile(readFixture(t, "development.mobileprovision"))
+	if err != nil {
+		t.Fatalf("ParseProfile failed: %v", err)
+	}
+	if len(p.TeamIdentifier) != 1 || p.TeamIdentifier[0] != "TEAMAAAAAA" {
+		t.Errorf("TeamIdentifier = %v, want [TEAMAAAAAA]", p.TeamIdentifier)
+	}
+	if p.TeamName != "Jane Doe" || len(p.ProvisionedDevices) != 1 {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+	if want := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC); !p.ExpirationDate.Equal(want) {
+		t.Errorf("ExpirationDate = %v, want %v", p.ExpirationDate, want)
+	}
+
+	if _, err := ParseProfile([]byte("garbage")); err == nil {
+		t.Error("expected error for invalid profile")
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	profiles := LoadProfiles("testdata", filepath.Join("testdata", "missing"))
+	if len(profiles) != 2 {
+		t.Errorf("got %d profiles, want 2", len(profiles))
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	ids := ParseIdentities(string(readFixture(t, "find-identity.txt")))
+	certTeams := TeamsFromCertificates(readFixture(t, "certificates.pem"), ids)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("profiles narrow the choice", func(t *testing.T) {
+		teams := Candidates(ids, certTeams, LoadProfiles("testdata"), now)
+		team, err := Choose(teams)
+		if err != nil {
+			t.Fatalf("Choose failed: %v", err)
+		}
+		if team.ID != "TEAMAAAAAA" || team.Name != "Jane Doe" || team.Profiles != 1 {
+			t.Errorf("unexpected team: %+v", team)
+		}
+	})
+
+	t.Run("no profiles", func(t *testing.T) {
+		teams := Candidates(ids, certTeams, nil, now)
+		if len(teams) != 2 {
+			t.Fatalf("got %d teams, want 2", len(teams))
+		}
+		if _, err := Choose(teams); err == nil {
+			t.Error("expected error for multiple teams")
+		}
+	})
+
+	t.Run("no identities", func(t *testing.T) {
+		if _, err := Choose(Candidates(nil, nil, LoadProfiles("testdata"), now)); err == nil {
+			t.Error("expected error without identities")
+		}
+	})
+}
+
+// fakeSecurity scripts security to list the fixture identities and
+// certificates.
+func fakeSecurity(t *testing.T, identities string) *execx.Fake {
+	t.Helper()
+	certs := readFixture(t, "certificates.pem")
+	fake := execx.NewFake()
+	fake.Handle("security", func(_ context.Context, args []string, out io.Writer) error {
+		switch args[0] {
+		case "find-identity":
+			io.WriteString(out, identities)
+		case "find-certificate":
+			out.Write(certs)
+		}
+		return nil
+	})
+	t.Cleanup(SetExecutor(fake))
+	return fake
+}
+
+func TestTeams(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	profiles := filepath.Join(home, "Library", "MobileDevice", "Provisioning Profiles")
+	os.MkdirAll(profiles, 0755)
+	os.WriteFile(filepath.Join(profiles, "development.mobileprovision"), readFixture(t, "development.mobileprovision"), 0644)
+
+	fake := fakeSecurity(t, string(readFixture(t, "find-identity.txt")))
+	teams, err := Teams()
+	if err != nil {
+		t.Fatalf("Teams() = %v", err)
+	}
+	if len(teams) != 1 || teams[0].ID != "TEAMAAAAAA" {
+		t.Errorf("Teams() = %+v, want only TEAMAAAAAA", teams)
+	}
+	if calls := fake.Calls(); len(calls) != 2 || calls[0].String() != "security find-identity -v -p codesigning" {
+		t.Errorf("calls = %v", calls)
+	}
+
+	t.Run("no identities", func(t *testing.T) {
+		fake := fakeSecurity(t, "     0 valid identities found\n")
+		if teams, err := Teams(); err != nil || len(teams) != 0 {
+			t.Errorf("Teams() = %v, %v; want none", teams, err)
+		}
+		if n := len(fake.Calls()); n != 1 {
+			t.Errorf("ran security %d times, want only find-identity", n)
+		}
+	})
+
+	t.Run("keychain locked", func(t *testing.T) {
+		fake := execx.NewFake()
+		fake.Handle("security", execx.Fail("security: SecKeychainSearchCopyNext: The user name or passphrase you entered is not correct.\n", 51))
+		t.Cleanup(SetExecutor(fake))
+		if _, err := Teams(); err == nil {
+			t.Error("Teams() = nil error, want the security failure")
+		}
+	})
+}
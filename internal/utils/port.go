@@ -1,12 +1,18 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"net"
 )
 
 const startPort = 6001
 
+var (
+	ErrPortInUse  = errors.New("port already in use")
+	ErrNoFreePort = errors.New("no free port found")
+)
+
 func IsPortBusy(port int) bool {
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
@@ -19,7 +25,7 @@ func IsPortBusy(port int) bool {
 func ResolvePort(port int) (int, error) {
 	if port > 0 {
 		if IsPortBusy(port) {
-			return 0, fmt.Errorf("port %d already in use", port)
+			return 0, fmt.Errorf("%w: %d", ErrPortInUse, port)
 		}
 		return port, nil
 	}
@@ -29,5 +35,25 @@ func ResolvePort(port int) (int, error) {
 			return p, nil
 		}
 	}
-	return 0, fmt.Errorf("no free port found")
+	return 0, ErrNoFreePort
+}
+
+// ResolvePorts returns count free ports. The first is port when set (and must
+// be free); the rest are the next free ports after it.
+func ResolvePorts(port, count int) ([]int, error) {
+	first, err := ResolvePort(port)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := []int{first}
+	for p := first + 1; len(ports) < count && p < 65535; p++ {
+		if !IsPortBusy(p) {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) < count {
+		return nil, ErrNoFreePort
+	}
+	return ports, nil
 }
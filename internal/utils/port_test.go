@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"testing"
 )
@@ -54,8 +56,8 @@ func TestResolvePort_Busy(t *testing.T) {
 	busyPort := ln.Addr().(*net.TCPAddr).Port
 
 	_, err = ResolvePort(busyPort)
-	if err == nil {
-		t.Error("expected error for busy port")
+	if !errors.Is(err, ErrPortInUse) {
+		t.Errorf("got %v, want ErrPortInUse", err)
 	}
 }
 
@@ -68,3 +70,31 @@ func TestResolvePort_Auto(t *testing.T) {
 		t.Errorf("got %d, want >= %d", port, startPort)
 	}
 }
+
+func TestResolvePorts(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	// Occupy the port right after base so it gets skipped
+	busy, err := net.Listen("tcp", fmt.Sprintf(":%d", base+1))
+	if err != nil {
+		t.Skip("neighbouring port not available")
+	}
+	defer busy.Close()
+
+	ports, err := ResolvePorts(base, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ports) != 2 || ports[0] != base || ports[1] <= base+1 {
+		t.Errorf("got %v, want [%d, >%d]", ports, base, base+1)
+	}
+
+	if _, err := ResolvePorts(base+1, 2); err == nil {
+		t.Error("expected error when the requested port is busy")
+	}
+}
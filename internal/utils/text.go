@@ -0,0 +1,18 @@
+package utils
+
+// OrDash returns s, or "-" when s is empty, for table cells.
+func OrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ShortUDID returns the last 8 characters of udid, enough to tell devices
+// apart in log prefixes.
+func ShortUDID(udid string) string {
+	if len(udid) > 8 {
+		return udid[len(udid)-8:]
+	}
+	return udid
+}
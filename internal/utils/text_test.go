@@ -0,0 +1,19 @@
+package utils
+
+import "testing"
+
+func TestShortUDID(t *testing.T) {
+	tests := []struct {
+		udid string
+		want string
+	}{
+		{"00008030-001234567890", "34567890"},
+		{"12345678", "12345678"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := ShortUDID(tt.udid); got != tt.want {
+			t.Errorf("ShortUDID(%q) = %q, want %q", tt.udid, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package watchdog keeps a bridge alive: it restarts the runner when its
+// process exits or the driver stops answering.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrGaveUp is returned once the target cannot be restarted.
+var ErrGaveUp = errors.New("gave up")
+
+// Target is the thing being supervised.
+type Target interface {
+	// Exited is closed when the supervised process exits.
+	Exited() <-chan struct{}
+	// Healthy returns an error when the driver does not answer.
+	Healthy(ctx context.Context) error
+	// Restart brings the target back up from scratch.
+	Restart(ctx context.Context) error
+}
+
+type Options struct {
+	// MaxRestarts caps the restarts over the watchdog's lifetime. Zero
+	// disables restarting.
+	MaxRestarts int
+	// Interval between health checks.
+	Interval time.Duration
+	// Failures is how many health checks in a row must fail before a restart.
+	Failures int
+	// MinBackoff and MaxBackoff bound the wait before each restart, which
+	// doubles with every restart that does not stay up for StableAfter.
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	StableAfter time.Duration
+	// Logf reports restarts.
+	Logf func(format string, args ...any)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxRestarts: 5,
+		Interval:    5 * time.Second,
+		Failures:    3,
+		MinBackoff:  2 * time.Second,
+		MaxBackoff:  time.Minute,
+		StableAfter: 2 * time.Minute,
+		Logf:        func(string, ...any) {},
+	}
+}
+
+// Run supervises t until ctx is done, which returns nil, or until the
+// target cannot be brought back, which returns the reason.
+func Run(ctx context.Context, t Target, opts Options) error {
+	restarts := 0
+	backoff := opts.MinBackoff
+	upSince := time.Now()
+
+	for {
+		reason := watch(ctx, t, opts)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if restarts >= opts.MaxRestarts {
+			return fmt.Errorf("%s; %w after %d restart(s)", reason, ErrGaveUp, restarts)
+		}
+		if time.Since(upSince) >= opts.StableAfter {
+			backoff = opts.MinBackoff
+		}
+
+		for {
+			restarts++
+			opts.Logf("🔁 %s; restarting in %s (%d/%d)", reason, backoff, restarts, opts.MaxRestarts)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, opts.MaxBackoff)
+
+			err := t.Restart(ctx)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == nil {
+				break
+			}
+			reason = fmt.Sprintf("restart failed: %s", err)
+			if restarts >= opts.MaxRestarts {
+				return fmt.Errorf("%s; %w after %d restart(s)", reason, ErrGaveUp, restarts)
+			}
+		}
+
+		opts.Logf("✅ Runner restarted")
+		upSince = time.Now()
+	}
+}
+
+// watch blocks until the target exits, fails its health checks or ctx is
+// done, and says why.
+func watch(ctx context.Context, t Target, opts Options) string {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-t.Exited():
+			return "runner exited"
+		case <-ticker.C:
+			err := t.Healthy(ctx)
+			if err == nil {
+				failures = 0
+				continue
+			}
+			if ctx.Err() != nil {
+				return ""
+			}
+			failures++
+			if failures >= opts.Failures {
+				return fmt.Sprintf("driver not responding (%s)", err)
+			}
+		}
+	}
+}
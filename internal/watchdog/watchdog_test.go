@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	mu         sync.Mutex
+	exited     chan struct{}
+	healthErr  error
+	restartErr error
+	restarts   int
+	onRestart  func(n int)
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{exited: make(chan struct{})}
+}
+
+func (f *fakeTarget) Exited() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.exited
+}
+
+func (f *fakeTarget) Healthy(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthErr
+}
+
+func (f *fakeTarget) Restart(context.Context) error {
+	f.mu.Lock()
+	f.restarts++
+	n, err, hook := f.restarts, f.restartErr, f.onRestart
+	if err == nil {
+		f.exited = make(chan struct{})
+	}
+	f.mu.Unlock()
+	if hook != nil {
+		hook(n)
+	}
+	return err
+}
+
+func (f *fakeTarget) crash() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.exited)
+}
+
+func testOptions(max int) Options {
+	return Options{
+		MaxRestarts: max,
+		Interval:    time.Millisecond,
+		Failures:    2,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  4 * time.Millisecond,
+		StableAfter: time.Hour,
+		Logf:        func(string, ...any) {},
+	}
+}
+
+func TestRun_RestartsOnExit(t *testing.T) {
+	f := newFakeTarget()
+	ctx, cancel := context.WithCancel(context.Background())
+	f.onRestart = func(n int) {
+		if n == 2 {
+			cancel()
+			return
+		}
+		go f.crash()
+	}
+
+	f.crash()
+	if err := Run(ctx, f, testOptions(5)); err != nil {
+		t.Fatalf("Run() = %v, want nil after cancel", err)
+	}
+	if f.restarts != 2 {
+		t.Errorf("restarts = %d, want 2", f.restarts)
+	}
+}
+
+func TestRun_GivesUp(t *testing.T) {
+	f := newFakeTarget()
+	f.healthErr = errors.New("connection refused")
+	f.restartErr = errors.New("device gone")
+
+	err := Run(context.Background(), f, testOptions(3))
+	if err == nil {
+		t.Fatal("expected Run to give up")
+	}
+	if f.restarts != 3 {
+		t.Errorf("restarts = %d, want 3", f.restarts)
+	}
+}
+
+func TestRun_NoRestarts(t *testing.T) {
+	f := newFakeTarget()
+	f.crash()
+
+	if err := Run(context.Background(), f, testOptions(0)); err == nil {
+		t.Fatal("expected error with restarts disabled")
+	}
+	if f.restarts != 0 {
+		t.Errorf("restarts = %d, want 0", f.restarts)
+	}
+}
+
+func TestRun_StopsOnCancel(t *testing.T) {
+	f := newFakeTarget()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if err := Run(ctx, f, testOptions(5)); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if f.restarts != 0 {
+		t.Errorf("healthy target was restarted %d time(s)", f.restarts)
+	}
+}
@@ -0,0 +1,74 @@
+package xclog
+
+import "sync"
+
+// subscriberBuffer is how many events a slow subscriber can fall behind
+// before it starts missing them.
+const subscriberBuffer = 256
+
+// Hub fans events out to any number of subscribers. Publishing never
+// blocks, so a stalled subscriber cannot hold up xcodebuild's output.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events published from now on, closed when
+// the hub closes, and a func to stop receiving them.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *Hub) Publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Close closes every subscriber's channel.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for ch := range h.subs {
+		close(ch)
+	}
+	h.subs = nil
+}
+
+// Run publishes everything from events and closes the hub when it ends.
+func (h *Hub) Run(events <-chan Event) {
+	for ev := range events {
+		h.Publish(ev)
+	}
+	h.Close()
+}
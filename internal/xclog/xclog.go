@@ -0,0 +1,176 @@
+// Package xclog parses xcodebuild and XCTest output into events as it is
+// written, so callers never re-read a growing log.
+package xclog
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type Kind int
+
+const (
+	SuiteStarted Kind = iota + 1
+	SuiteFinished
+	CaseStarted
+	CasePassed
+	CaseFailed
+	// Failure is an assertion or error reported inside a test case.
+	Failure
+	// TestingFailed is a "Testing failed:" block; Message holds its reasons.
+	TestingFailed
+	// Error is an "xcodebuild: error:" line and any indented detail after it.
+	Error
+	// Result is the closing "** TEST ... **" banner.
+	Result
+)
+
+var kindNames = map[Kind]string{
+	SuiteStarted:  "suite-started",
+	SuiteFinished: "suite-finished",
+	CaseStarted:   "case-started",
+	CasePassed:    "case-passed",
+	CaseFailed:    "case-failed",
+	Failure:       "failure",
+	TestingFailed: "testing-failed",
+	Error:         "error",
+	Result:        "result",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Kind Kind
+	// Name is the suite or test case, e.g. "maestro_driver_iosUITests.testHttpServer".
+	Name string
+	// Message is the failure text, error detail or result banner.
+	Message string
+}
+
+var (
+	suiteStarted  = regexp.MustCompile(`^Test Suite '(.+)' started at`)
+	suiteFinished = regexp.MustCompile(`^Test Suite '(.+)' (passed|failed) at`)
+	caseStarted   = regexp.MustCompile(`^Test Case '(.+)' started\.`)
+	caseFinished  = regexp.MustCompile(`^Test Case '(.+)' (passed|failed) \((.+)\)\.`)
+	failure       = regexp.MustCompile(`^.+:\d+: error: (-\[.+?\]) : (.*)$`)
+	result        = regexp.MustCompile(`^\*\* (TEST .+) \*\*$`)
+	objcName      = regexp.MustCompile(`^-\[(\S+) (\S+)\]$`)
+)
+
+// Parser turns lines into events. A Parser is not safe for concurrent use.
+type Parser struct {
+	// block collects a multi-line Testing failed or error block
+	block *Event
+	lines []string
+}
+
+// Feed parses one line, without its newline, and returns any events it
+// completes.
+func (p *Parser) Feed(line string) []Event {
+	line = strings.TrimRight(line, "\r")
+
+	var events []Event
+	if p.block != nil {
+		if isDetail(line) {
+			p.lines = append(p.lines, strings.TrimSpace(line))
+			return nil
+		}
+		events = p.Flush()
+	}
+
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "Testing failed:":
+		p.block = &Event{Kind: TestingFailed}
+	case strings.HasPrefix(trimmed, "xcodebuild: error:"):
+		p.block = &Event{Kind: Error}
+		p.lines = append(p.lines, strings.TrimSpace(strings.TrimPrefix(trimmed, "xcodebuild: error:")))
+	default:
+		if ev, ok := parseLine(trimmed); ok {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// Flush completes a pending block, as at the end of the output.
+func (p *Parser) Flush() []Event {
+	if p.block == nil {
+		return nil
+	}
+	ev := *p.block
+	ev.Message = strings.Join(p.lines, "\n")
+	p.block, p.lines = nil, nil
+	return []Event{ev}
+}
+
+// isDetail reports whether line continues a block: block details are
+// indented, and Xcode writes them with a leading tab.
+func isDetail(line string) bool {
+	return strings.TrimSpace(line) != "" && (line[0] == '\t' || line[0] == ' ')
+}
+
+func parseLine(line string) (Event, bool) {
+	if m := suiteStarted.FindStringSubmatch(line); m != nil {
+		return Event{Kind: SuiteStarted, Name: m[1]}, true
+	}
+	if m := suiteFinished.FindStringSubmatch(line); m != nil {
+		return Event{Kind: SuiteFinished, Name: m[1], Message: m[2]}, true
+	}
+	if m := caseStarted.FindStringSubmatch(line); m != nil {
+		return Event{Kind: CaseStarted, Name: caseName(m[1])}, true
+	}
+	if m := caseFinished.FindStringSubmatch(line); m != nil {
+		kind := CasePassed
+		if m[2] == "failed" {
+			kind = CaseFailed
+		}
+		return Event{Kind: kind, Name: caseName(m[1]), Message: m[3]}, true
+	}
+	if m := failure.FindStringSubmatch(line); m != nil {
+		return Event{Kind: Failure, Name: caseName(m[1]), Message: strings.TrimPrefix(m[2], "failed - ")}, true
+	}
+	if m := result.FindStringSubmatch(line); m != nil {
+		return Event{Kind: Result, Message: m[1]}, true
+	}
+	return Event{}, false
+}
+
+// caseName turns "-[Module.Class testName]" into "Module.Class.testName".
+func caseName(s string) string {
+	if m := objcName.FindStringSubmatch(s); m != nil {
+		return m[1] + "." + m[2]
+	}
+	return s
+}
+
+// Stream parses r until EOF and sends each event on the returned channel,
+// which is closed at the end.
+func Stream(r io.Reader) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+
+		var p Parser
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			for _, ev := range p.Feed(sc.Text()) {
+				ch <- ev
+			}
+		}
+		for _, ev := range p.Flush() {
+			ch <- ev
+		}
+		// Keep draining so the writer never blocks on a line we cannot parse
+		io.Copy(io.Discard, r)
+	}()
+	return ch
+}
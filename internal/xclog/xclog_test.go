@@ -0,0 +1,118 @@
+package xclog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const driverCase = "maestro_driver_iosUITests.maestro_driver_iosUITests.testHttpServer"
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []Event
+	}{
+		{"started.log", []Event{
+			{Kind: SuiteStarted, Name: "All tests"},
+			{Kind: SuiteStarted, Name: "maestro-driver-iosUITests.xctest"},
+			{Kind: SuiteStarted, Name: "maestro_driver_iosUITests"},
+			{Kind: CaseStarted, Name: driverCase},
+		}},
+		{"untrusted.log", []Event{
+			{Kind: TestingFailed, Message: "The application could not be launched because the Developer App Certificate is not trusted.\n" +
+				"maestro-driver-iosUITests-Runner encountered an error (Failed to install or launch the test runner. (Underlying Error: Unable to launch com.devicelab.maestro-driver-iosUITests.xctrunner because it has an invalid code signature, inadequate entitlements or its profile has not been explicitly trusted by the user.))"},
+			{Kind: Result, Message: "TEST EXECUTE FAILED"},
+		}},
+		{"crashed.log", []Event{
+			{Kind: SuiteStarted, Name: "All tests"},
+			{Kind: SuiteStarted, Name: "maestro-driver-iosUITests.xctest"},
+			{Kind: SuiteStarted, Name: "maestro_driver_iosUITests"},
+			{Kind: CaseStarted, Name: driverCase},
+			{Kind: Failure, Name: driverCase, Message: "Lost connection to the test runner"},
+			{Kind: CaseFailed, Name: driverCase, Message: "1843.207 seconds"},
+			{Kind: SuiteFinished, Name: "maestro_driver_iosUITests", Message: "failed"},
+			{Kind: SuiteFinished, Name: "maestro-driver-iosUITests.xctest", Message: "failed"},
+			{Kind: SuiteFinished, Name: "All tests", Message: "failed"},
+			{Kind: Result, Message: "TEST EXECUTE FAILED"},
+		}},
+		{"no-destination.log", []Event{
+			{Kind: Error, Message: "Unable to find a destination matching the provided destination specifier:\n{ id:00008030-001234567890 }"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var got []Event
+			for ev := range Stream(f) {
+				got = append(got, ev)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stream() events:\n%s\nwant:\n%s", formatEvents(got), formatEvents(tt.want))
+			}
+		})
+	}
+}
+
+func TestParser_FlushAtEnd(t *testing.T) {
+	var p Parser
+	if evs := p.Feed("Testing failed:"); len(evs) != 0 {
+		t.Fatalf("Feed() = %v before the block ended", evs)
+	}
+	p.Feed("\tmaestro-driver-iosUITests-Runner (1822) encountered an error")
+
+	evs := p.Flush()
+	if len(evs) != 1 || evs[0].Kind != TestingFailed || !strings.Contains(evs[0].Message, "encountered an error") {
+		t.Errorf("Flush() = %v", evs)
+	}
+	if evs := p.Flush(); len(evs) != 0 {
+		t.Errorf("second Flush() = %v", evs)
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	a, _ := h.Subscribe()
+	b, cancel := h.Subscribe()
+
+	h.Publish(Event{Kind: CaseStarted})
+	cancel()
+	h.Publish(Event{Kind: CaseFailed})
+	h.Close()
+
+	var kinds []Kind
+	for ev := range a {
+		kinds = append(kinds, ev.Kind)
+	}
+	if !reflect.DeepEqual(kinds, []Kind{CaseStarted, CaseFailed}) {
+		t.Errorf("subscriber a got %v", kinds)
+	}
+
+	if ev := <-b; ev.Kind != CaseStarted {
+		t.Errorf("subscriber b got %v", ev)
+	}
+	if _, ok := <-b; ok {
+		t.Error("cancelled subscriber should be closed")
+	}
+
+	late, _ := h.Subscribe()
+	if _, ok := <-late; ok {
+		t.Error("subscribing to a closed hub should return a closed channel")
+	}
+}
+
+func formatEvents(evs []Event) string {
+	var b strings.Builder
+	for _, ev := range evs {
+		b.WriteString("  " + ev.Kind.String() + " " + ev.Name + " " + strings.ReplaceAll(ev.Message, "\n", `\n`) + "\n")
+	}
+	return b.String()
+}
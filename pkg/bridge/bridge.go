@@ -0,0 +1,425 @@
+// Package bridge starts the XCTest driver on a real iOS device and forwards
+// it to a local port, so Maestro (or any other client) can drive the device
+// through --driver-host-port. It is what the maestro-ios-device CLI runs for
+// every device, exposed for tools that want a bridge in-process:
+//
+//	b, err := bridge.New(bridge.Options{UDID: udid})
+//	if err != nil { ... }
+//	defer b.Stop()
+//	if err := b.Start(ctx); err != nil { ... }
+//	// maestro --driver-host-port b.Port() --device udid test flow.yaml
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/registry"
+	"github.com/anthropics/maestro-ios-device/internal/runner"
+	"github.com/anthropics/maestro-ios-device/internal/signing"
+	"github.com/anthropics/maestro-ios-device/internal/utils"
+	"github.com/anthropics/maestro-ios-device/internal/watchdog"
+)
+
+// Errors callers can match with errors.Is.
+var (
+	ErrDeviceNotFound = device.ErrNotFound
+	ErrNoDevices      = device.ErrNoDevices
+	ErrAmbiguous      = device.ErrAmbiguous
+	ErrNoTeam         = signing.ErrNoTeam
+	ErrPortInUse      = utils.ErrPortInUse
+	ErrBuildFailed    = runner.ErrBuildFailed
+	ErrStartFailed    = runner.ErrStartFailed
+	ErrForwardFailed  = portforward.ErrForwardFailed
+	ErrGaveUp         = watchdog.ErrGaveUp
+
+	ErrStarted    = errors.New("bridge already started")
+	ErrNotRunning = errors.New("bridge is not running")
+)
+
+type Options struct {
+	// UDID of the device. Empty picks the only connected device.
+	UDID string
+	// TeamID signs the runner. Empty detects it from the signing identities.
+	TeamID string
+	// Port on this host. Zero picks a free one from 6001.
+	Port int
+	// CacheDir holds runner builds. Empty uses ~/.maestro/cache/builds.
+	CacheDir string
+	// BuildTimeout and StartupTimeout bound xcodebuild; zero keeps the
+	// runner's defaults.
+	BuildTimeout   time.Duration
+	StartupTimeout time.Duration
+	// MaxRestarts caps how often a crashed or unresponsive runner is
+	// restarted. Zero disables restarting.
+	MaxRestarts int
+	// LogPrefix is put in front of every line the bridge prints.
+	LogPrefix string
+	// Output receives the bridge's progress lines. Nil prints to stdout.
+	Output io.Writer
+	// OnEvent, if set, is called for every state change. It runs on the
+	// bridge's goroutines and must not block.
+	OnEvent func(Event)
+}
+
+// DefaultOptions returns the options the CLI starts from.
+func DefaultOptions() Options {
+	return Options{MaxRestarts: watchdog.DefaultOptions().MaxRestarts}
+}
+
+// Device describes the device a bridge serves.
+type Device struct {
+	UDID      string
+	Name      string
+	OSVersion string
+}
+
+// Bridge is one device's runner and port forward.
+type Bridge struct {
+	opts   Options
+	dev    device.Device
+	port   int
+	runner *runner.Runner
+
+	ready    chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	pf      *portforward.PortForwarder
+	cancel  context.CancelFunc
+	stopped bool
+	err     error
+	// exited is closed when the current runner exits on its own, not when
+	// restart stops it; gen tells the runners apart.
+	exited chan struct{}
+	gen    int
+
+	restartMu  sync.Mutex
+	restarting atomic.Bool
+}
+
+// New resolves the device, Team ID and port. Nothing is built or started
+// until Start.
+func New(opts Options) (*Bridge, error) {
+	dev, err := findDevice(opts.UDID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TeamID == "" {
+		team, err := signing.Detect()
+		if err != nil {
+			return nil, fmt.Errorf("Could not detect Team ID: %w", err)
+		}
+		opts.TeamID = team.ID
+	}
+
+	port, err := utils.ResolvePort(opts.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	r := runner.New(dev.Serial, opts.TeamID)
+	r.SetTimeouts(opts.BuildTimeout, opts.StartupTimeout)
+	r.SetCacheDir(opts.CacheDir)
+	r.SetLogPrefix(opts.LogPrefix)
+	if opts.Output != nil {
+		r.SetOutput(opts.Output)
+	}
+
+	return &Bridge{
+		opts:   opts,
+		dev:    *dev,
+		port:   port,
+		runner: r,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func findDevice(udid string) (*device.Device, error) {
+	if udid != "" {
+		return device.Get(udid)
+	}
+
+	list, err := device.List()
+	if err != nil {
+		return nil, err
+	}
+	switch len(list) {
+	case 0:
+		return nil, ErrNoDevices
+	case 1:
+		return &list[0], nil
+	}
+	return nil, fmt.Errorf("%w, set Options.UDID", ErrAmbiguous)
+}
+
+// Start builds the runner (or reuses a cached build), launches it on the
+// device and forwards the port. It returns once the driver answers, or with
+// the reason it could not. The bridge then stays up, restarting the runner
+// as needed, until ctx is done or Stop is called. When Start fails, the
+// runner and port forward are stopped but the logs are kept for Err.
+func (b *Bridge) Start(ctx context.Context) error {
+	b.mu.Lock()
+	if b.cancel != nil || b.stopped {
+		b.mu.Unlock()
+		return ErrStarted
+	}
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.mu.Unlock()
+
+	if err := b.start(ctx); err != nil {
+		b.cancel()
+		b.setErr(err)
+		b.teardown()
+		close(b.done)
+		b.emit(Event{Kind: Failed, Err: err})
+		return err
+	}
+
+	close(b.ready)
+	b.emit(Event{Kind: Ready})
+	go b.supervise(ctx)
+	return nil
+}
+
+func (b *Bridge) start(ctx context.Context) error {
+	b.emit(Event{Kind: Building})
+	if err := b.runner.Build(ctx); err != nil {
+		return err
+	}
+	if err := b.launch(ctx); err != nil {
+		return err
+	}
+
+	if err := registry.Register(b.dev.Serial, b.port); err != nil {
+		b.runner.Logf("⚠️  Could not record bridge for %s: %s", b.dev.Serial, err)
+	}
+	return nil
+}
+
+// launch starts the runner from the existing build and forwards the port.
+func (b *Bridge) launch(ctx context.Context) error {
+	b.emit(Event{Kind: Starting})
+	if err := b.runner.Start(ctx); err != nil {
+		return err
+	}
+	b.watchExit()
+
+	pf := portforward.New(b.dev.Entry, uint16(b.port), runner.DevicePort)
+	b.mu.Lock()
+	b.pf = pf
+	b.mu.Unlock()
+	if err := pf.Start(); err != nil {
+		return err
+	}
+
+	h, err := pf.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	b.runner.Logf("🔗 Driver answered in %s: %s", h.Latency.Round(time.Millisecond), h.Body)
+	return nil
+}
+
+func (b *Bridge) supervise(ctx context.Context) {
+	defer close(b.done)
+
+	opts := watchdog.DefaultOptions()
+	opts.MaxRestarts = b.opts.MaxRestarts
+	opts.Logf = b.runner.Logf
+	if err := watchdog.Run(ctx, target{b}, opts); err != nil {
+		b.setErr(err)
+		b.runner.Logf("❌ %s", err)
+		b.emit(Event{Kind: Failed, Err: err})
+	}
+}
+
+// Stop shuts the runner and port forward down and waits for them. The run's
+// logs are removed unless the bridge failed, so the log named by Err stays
+// readable. It is safe to call at any time, more than once.
+func (b *Bridge) Stop() {
+	b.stopOnce.Do(func() {
+		b.mu.Lock()
+		b.stopped = true
+		cancel := b.cancel
+		b.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+			<-b.done
+		} else {
+			close(b.done)
+		}
+		b.teardown()
+		b.emit(Event{Kind: Stopped})
+	})
+}
+
+func (b *Bridge) teardown() {
+	registry.Unregister(b.dev.Serial)
+	b.mu.Lock()
+	if b.pf != nil {
+		b.pf.Stop()
+	}
+	failed := b.err != nil
+	b.mu.Unlock()
+	if failed {
+		b.runner.CleanupKeepLogs()
+	} else {
+		b.runner.Cleanup()
+	}
+}
+
+// Ready is closed once the driver answers through the port.
+func (b *Bridge) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Done is closed when the bridge is down for good: Start failed, Stop was
+// called, its context ended or the runner could not be restarted. Err says
+// which.
+func (b *Bridge) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns why the bridge failed, or nil.
+func (b *Bridge) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *Bridge) setErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+// Port is the local port Maestro connects to.
+func (b *Bridge) Port() int {
+	return b.port
+}
+
+func (b *Bridge) Device() Device {
+	return Device{UDID: b.dev.Serial, Name: b.dev.Name, OSVersion: b.dev.OSVersion}
+}
+
+// LogPath is the last xcodebuild log: the build's, or the runner's once it
+// started. Stop removes it unless the bridge failed.
+func (b *Bridge) LogPath() string {
+	return b.runner.LogPath()
+}
+
+// Logf prints a line with the bridge's log prefix.
+func (b *Bridge) Logf(format string, args ...any) {
+	b.runner.Logf(format, args...)
+}
+
+func (b *Bridge) emit(ev Event) {
+	if b.opts.OnEvent == nil {
+		return
+	}
+	ev.UDID = b.dev.Serial
+	ev.Port = b.port
+	ev.Time = time.Now()
+	b.opts.OnEvent(ev)
+}
+
+// watchExit arranges for exited to close when the runner just started
+// exits, unless restart replaced it first.
+func (b *Bridge) watchExit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	exited := make(chan struct{})
+	b.exited = exited
+	gen := b.gen
+	go func(done <-chan struct{}) {
+		<-done
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.gen == gen {
+			close(exited)
+		}
+	}(b.runner.Exited())
+}
+
+// Restart relaunches the runner from the existing build and forwards the
+// port again, e.g. to retry a flow on a fresh runner. The port stays the
+// same.
+func (b *Bridge) Restart(ctx context.Context) error {
+	select {
+	case <-b.ready:
+	default:
+		return ErrNotRunning
+	}
+	select {
+	case <-b.done:
+		return ErrNotRunning
+	default:
+	}
+	return b.restart(ctx)
+}
+
+func (b *Bridge) restart(ctx context.Context) error {
+	b.restartMu.Lock()
+	defer b.restartMu.Unlock()
+	b.restarting.Store(true)
+	defer b.restarting.Store(false)
+
+	b.emit(Event{Kind: Restarting})
+	b.mu.Lock()
+	b.gen++
+	if b.pf != nil {
+		b.pf.Stop()
+	}
+	b.mu.Unlock()
+	b.runner.Stop()
+
+	// After a reconnect the device has a new usbmuxd entry
+	dev, err := device.Get(b.dev.Serial)
+	if err != nil {
+		return err
+	}
+	b.dev.Entry = dev.Entry
+	if err := b.launch(ctx); err != nil {
+		return err
+	}
+	b.emit(Event{Kind: Ready})
+	return nil
+}
+
+// target lets the watchdog supervise the bridge without exporting its
+// methods.
+type target struct{ b *Bridge }
+
+func (t target) Exited() <-chan struct{} {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	return t.b.exited
+}
+
+func (t target) Healthy(ctx context.Context) error {
+	// Restart reports for itself
+	if t.b.restarting.Load() {
+		return nil
+	}
+	if err := t.b.runner.Failed(); err != nil {
+		return err
+	}
+	_, err := portforward.Probe(ctx, t.b.port)
+	return err
+}
+
+func (t target) Restart(ctx context.Context) error {
+	return t.b.restart(ctx)
+}
@@ -0,0 +1,228 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/maestro-ios-device/internal/device"
+	"github.com/anthropics/maestro-ios-device/internal/diagnose"
+	"github.com/anthropics/maestro-ios-device/internal/execx"
+	"github.com/anthropics/maestro-ios-device/internal/fakemac"
+	"github.com/anthropics/maestro-ios-device/internal/portforward"
+	"github.com/anthropics/maestro-ios-device/internal/registry"
+)
+
+const testUDID = fakemac.UDID
+
+// recorder collects the kinds of events a bridge reports.
+type recorder struct {
+	mu    sync.Mutex
+	kinds []EventKind
+}
+
+func (r *recorder) record(ev Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds = append(r.kinds, ev.Kind)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprint(r.kinds)
+}
+
+func TestBridge(t *testing.T) {
+	fakemac.New(t)
+	var events recorder
+
+	b, err := New(Options{TeamID: "TEAM123456", OnEvent: events.record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := b.Device(); d.UDID != testUDID || d.Name != "Test iPhone" {
+		t.Errorf("Device() = %+v, want the only connected device", d)
+	}
+
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	select {
+	case <-b.Ready():
+	default:
+		t.Fatal("Ready() not closed after Start")
+	}
+	if _, err := portforward.Probe(context.Background(), b.Port()); err != nil {
+		t.Errorf("driver not reachable on port %d: %v", b.Port(), err)
+	}
+	if e, ok := registry.Lookup(testUDID); !ok || e.Port != b.Port() {
+		t.Errorf("registry entry = %+v, %v; want port %d", e, ok, b.Port())
+	}
+	if err := b.Start(context.Background()); !errors.Is(err, ErrStarted) {
+		t.Errorf("second Start() = %v, want ErrStarted", err)
+	}
+
+	b.Stop()
+	b.Stop()
+	select {
+	case <-b.Done():
+	default:
+		t.Fatal("Done() not closed after Stop")
+	}
+	if err := b.Err(); err != nil {
+		t.Errorf("Err() = %v after Stop, want nil", err)
+	}
+	if _, ok := registry.Lookup(testUDID); ok {
+		t.Error("bridge still registered after Stop")
+	}
+	if _, err := os.Stat(b.LogPath()); !os.IsNotExist(err) {
+		t.Errorf("log %s kept after a clean Stop", b.LogPath())
+	}
+	if got, want := events.String(), "[building starting ready stopped]"; got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestBridge_GivesUp(t *testing.T) {
+	mac := fakemac.New(t)
+	var events recorder
+
+	b, err := New(Options{UDID: testUDID, TeamID: "TEAM123456", OnEvent: events.record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+
+	mac.ExitRunners()
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge still up after the runner exited")
+	}
+	if err := b.Err(); !errors.Is(err, ErrGaveUp) {
+		t.Errorf("Err() = %v, want ErrGaveUp", err)
+	}
+	if got, want := events.String(), "[building starting ready failed]"; got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestBridge_StartFails(t *testing.T) {
+	mac := fakemac.New(t)
+	mac.Exec.Handle("xcodebuild", func(ctx context.Context, args []string, out io.Writer) error {
+		if args[0] == "-version" {
+			fmt.Fprintln(out, "Xcode 16.2")
+			return nil
+		}
+		fmt.Fprintln(out, "** TEST BUILD FAILED **")
+		return &execx.ExitError{Code: 65}
+	})
+
+	b, err := New(Options{TeamID: "TEAM123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start(context.Background()); !errors.Is(err, ErrBuildFailed) {
+		t.Fatalf("Start() = %v, want ErrBuildFailed", err)
+	}
+	select {
+	case <-b.Done():
+	default:
+		t.Error("Done() not closed after a failed Start")
+	}
+
+	// The log named by the error outlives Start and Stop
+	var de *diagnose.Error
+	if !errors.As(b.Err(), &de) || de.Log == "" || de.Log != b.LogPath() {
+		t.Fatalf("Err() = %v, want a diagnosis naming LogPath() %q", b.Err(), b.LogPath())
+	}
+	b.Stop()
+	if _, err := os.Stat(de.Log); err != nil {
+		t.Errorf("log gone after Stop: %v", err)
+	}
+}
+
+func TestNew_Device(t *testing.T) {
+	mac := fakemac.New(t)
+	other := device.Device{Serial: "00008101-AAAA", Name: "Other", Paired: true}
+
+	tests := []struct {
+		name    string
+		devices []device.Device
+		udid    string
+		want    error
+	}{
+		{"none connected", nil, "", ErrNoDevices},
+		{"several connected", []device.Device{{Serial: testUDID}, other}, "", ErrAmbiguous},
+		{"unknown udid", []device.Device{other}, testUDID, ErrDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac.Devices.Set(tt.devices...)
+			if _, err := New(Options{UDID: tt.udid, TeamID: "TEAM123456"}); !errors.Is(err, tt.want) {
+				t.Errorf("New() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBridge_Restart(t *testing.T) {
+	mac := fakemac.New(t)
+	var events recorder
+
+	b, err := New(Options{TeamID: "TEAM123456", MaxRestarts: 1, OnEvent: events.record})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Restart(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Restart() before Start = %v, want ErrNotRunning", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	first := b.LogPath()
+
+	if err := b.Restart(context.Background()); err != nil {
+		t.Fatalf("Restart() = %v", err)
+	}
+	if _, err := portforward.Probe(context.Background(), b.Port()); err != nil {
+		t.Errorf("driver not reachable after Restart: %v", err)
+	}
+	// The first runner's log is kept next to the new one
+	if b.LogPath() == first {
+		t.Errorf("LogPath() = %s after Restart, want a new log", first)
+	}
+	if log, _ := os.ReadFile(first); !strings.Contains(string(log), "Test Suite 'All tests' started") {
+		t.Errorf("first runner's log = %q, want its output", log)
+	}
+
+	// Stopping the old runner must not look like a crash to the watchdog
+	time.Sleep(100 * time.Millisecond)
+	b.Stop()
+	if err := b.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+
+	runs := 0
+	for _, c := range mac.Exec.Calls() {
+		if c.Args[0] == "test-without-building" {
+			runs++
+		}
+	}
+	if runs != 2 {
+		t.Errorf("runner started %d times, want 2", runs)
+	}
+	if got, want := events.String(), "[building starting ready restarting starting ready stopped]"; got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
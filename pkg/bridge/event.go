@@ -0,0 +1,29 @@
+package bridge
+
+import "time"
+
+type EventKind string
+
+const (
+	// Building: the runner is being built or taken from the cache.
+	Building EventKind = "building"
+	// Starting: the runner is being launched on the device.
+	Starting EventKind = "starting"
+	// Ready: the driver answers through the port, after Start or a restart.
+	Ready EventKind = "ready"
+	// Restarting: the runner exited or stopped answering and is restarted.
+	Restarting EventKind = "restarting"
+	// Failed: Start failed or the runner could not be restarted. Err says why.
+	Failed EventKind = "failed"
+	// Stopped: Stop tore the bridge down.
+	Stopped EventKind = "stopped"
+)
+
+// Event reports a state change of a bridge.
+type Event struct {
+	Kind EventKind
+	UDID string
+	Port int
+	Time time.Time
+	Err  error
+}